@@ -0,0 +1,171 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build !rlog_nocaller
+
+package rlog
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// callerLookupEnabled is false if rlog was built with the rlog_nocaller tag.
+const callerLookupEnabled = true
+
+// runtimeCaller is used to look up the caller of the log functions. This can be
+// replaced by our tests, in order to simulate a failed lookup.
+var runtimeCaller = runtime.Caller
+
+// The maximum number of call sites in the callerSites cache. Call sites beyond
+// that are looked up every time.
+const maxCallerSites = 4096
+
+// Caller information of the call sites of the log functions, keyed by program
+// counter. A call site always has the same caller information, so this only
+// needs to be determined once.
+var (
+	callerSites     sync.Map
+	callerSiteCount int32
+)
+
+// getCaller returns the caller information of a call site. The skip argument
+// is the number of stack frames to ascend, with 0 identifying the caller of
+// getCaller. The second return value is false if the information could not be
+// determined.
+func getCaller(skip int) (*callerSite, bool) {
+	if len(settingSkipPackages) > 0 {
+		return getCallerOutsidePackages(skip + 1)
+	}
+	pc, fullFilePath, line, ok := runtimeCaller(skip + 1)
+	if !ok {
+		return nil, false
+	}
+	if site, ok := callerSites.Load(pc); ok {
+		return site.(*callerSite), true
+	}
+	site := &callerSite{
+		funcName: runtime.FuncForPC(pc).Name(),
+		file:     sourceFileName(fullFilePath),
+		line:     line,
+	}
+	if reserveCallerSite() {
+		// The caller info is prepared for cached sites only, since its
+		// cost is only worth it if it can be used again.
+		site.info = fmt.Sprintf("[%d %s:%d (%s)] ", os.Getpid(),
+			site.file, site.line, site.funcName)
+		if cached, loaded := callerSites.LoadOrStore(pc, site); loaded {
+			// Another goroutine cached the site in the meantime.
+			atomic.AddInt32(&callerSiteCount, -1)
+			return cached.(*callerSite), true
+		}
+	}
+	return site, true
+}
+
+// reserveCallerSite takes a place in the callerSites cache, unless it's full.
+func reserveCallerSite() bool {
+	for {
+		count := atomic.LoadInt32(&callerSiteCount)
+		if count >= maxCallerSites {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&callerSiteCount, count, count+1) {
+			return true
+		}
+	}
+}
+
+// getCallerOutsidePackages works like getCaller, but walks up the stack until
+// it finds the first frame outside of the packages listed in
+// RLOG_SKIP_PACKAGES. This way, log messages are attributed to the caller of
+// any wrappers around rlog, no matter how deeply they are nested.
+func getCallerOutsidePackages(skip int) (*callerSite, bool) {
+	// Unlike runtime.Caller, runtime.Callers counts itself as frame 0.
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !isSkippedPackage(packagePath(frame.Function)) {
+			return &callerSite{
+				funcName: frame.Function,
+				file:     sourceFileName(frame.File),
+				line:     frame.Line,
+			}, true
+		}
+		if !more {
+			return nil, false
+		}
+	}
+}
+
+// resetCallerSites clears the cache of call sites, after a setting changed,
+// which affects the caller information. The caller needs to hold the write
+// lock of initMutex.
+func resetCallerSites() {
+	callerSites = sync.Map{}
+	callerSiteCount = 0
+}
+
+// sourceFileName returns the file name to be logged for a source file. This
+// is the path relative to the prefix set via SetSourceTrim(), if the path
+// is within the directory of that prefix. Otherwise, it's the module and file
+// name.
+func sourceFileName(fullFilePath string) string {
+	if settingSourceTrim != "" {
+		p := strings.Replace(fullFilePath, `\`, "/", -1)
+		if strings.HasPrefix(p, settingSourceTrim+"/") {
+			return p[len(settingSourceTrim)+1:]
+		}
+	}
+	return moduleAndFileName(fullFilePath)
+}
+
+// isSkippedPackage checks whether a package path matches any of the packages
+// in RLOG_SKIP_PACKAGES. These may be given as full package path, or as its
+// trailing elements, for example "mycompany/logutil".
+func isSkippedPackage(pkgPath string) bool {
+	for _, p := range settingSkipPackages {
+		if pkgPath == p || strings.HasSuffix(pkgPath, "/"+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleAndFileName returns the last two elements of a file path, which are
+// the module (directory) and file name. Backslashes, as they may appear in
+// paths on Windows, are treated as path separators as well, so the result is
+// always separated by '/'.
+func moduleAndFileName(fullFilePath string) string {
+	fullFilePath = strings.Replace(fullFilePath, `\`, "/", -1)
+	// We only want to print or examine file and package name, so use the
+	// last two elements of the full path. The path package deals with
+	// different path formats on different systems, so we use that instead
+	// of just string-split.
+	dirPath, fileName := path.Split(fullFilePath)
+	var moduleName string
+	if dirPath != "" {
+		dirPath = dirPath[:len(dirPath)-1]
+		_, moduleName = path.Split(dirPath)
+	}
+	return moduleName + "/" + fileName
+}
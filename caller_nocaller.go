@@ -0,0 +1,33 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build rlog_nocaller
+
+package rlog
+
+// callerLookupEnabled is false if rlog was built with the rlog_nocaller tag.
+const callerLookupEnabled = false
+
+// getCaller never looks up any caller information when rlog was built with
+// the rlog_nocaller tag. This saves the cost of runtime.Caller() for every log
+// message. Only the global log and trace levels are applied and caller info
+// is shown as 'unknown'.
+func getCaller(skip int) (*callerSite, bool) {
+	return nil, false
+}
+
+// resetCallerSites does nothing, since there is no cache of call sites when
+// rlog was built with the rlog_nocaller tag.
+func resetCallerSites() {}
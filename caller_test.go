@@ -0,0 +1,211 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build !rlog_nocaller
+
+package rlog
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+// TestLogCallerUnknown simulates a failed lookup of the caller information.
+// A placeholder should be shown and only the global level should be
+// considered, even if a named filter would match.
+func TestLogCallerUnknown(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	runtimeCaller = func(skip int) (uintptr, string, int, bool) {
+		return 0, "", 0, false
+	}
+	defer func() { runtimeCaller = runtime.Caller }()
+
+	conf.logLevel = "*=DEBUG,WARN"
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+
+	Info("Test Info")
+	Warn("Test Warning")
+
+	checkLines := []string{
+		fmt.Sprintf("WARN     : [%d unknown:0 (unknown)] Test Warning", os.Getpid()),
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSkipPackages checks that frames of the listed packages are skipped when
+// determining the caller. Since this test itself is part of rlog, skipping the
+// rlog package attributes the messages to the test runner.
+func TestSkipPackages(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	pc, _, _, _ := runtime.Caller(0)
+	conf.skipPackages = "foo/bar, " + packagePath(runtime.FuncForPC(pc).Name())
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+
+	if site, _ := getCaller(0); site.funcName != "testing.tRunner" || site.file != "testing/testing.go" {
+		t.Fatalf("Incorrect caller %s in %s", site.funcName, site.file)
+	}
+}
+
+// TestCallerSiteCache checks that each call site is counted once in the cache
+// and that no more sites are added once it's full.
+func TestCallerSiteCache(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	for i := 0; i < 3; i++ {
+		if site, ok := getCaller(0); !ok || site.info == "" {
+			t.Fatalf("Call site should have been cached: %+v", site)
+		}
+	}
+	if callerSiteCount != 1 {
+		t.Fatalf("Expected 1 cached call site, got %d", callerSiteCount)
+	}
+
+	callerSiteCount = maxCallerSites
+	if site, ok := getCaller(0); !ok || site.info != "" {
+		t.Fatalf("Call site should not have been cached: %+v", site)
+	}
+	if callerSiteCount != maxCallerSites {
+		t.Fatalf("Expected %d cached call sites, got %d", maxCallerSites, callerSiteCount)
+	}
+}
+
+// BenchmarkCallerInfo measures log calls from a single call site, with caller
+// info enabled.
+func BenchmarkCallerInfo(b *testing.B) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logFile = ""
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+	SetOutput(writerFunc(func(p []byte) (int, error) { return len(p), nil }))
+	defer initialize(conf, true)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info("Test Info")
+	}
+}
+
+// TestModuleAndFileName checks the extraction of module and file name from
+// Unix and Windows paths.
+func TestModuleAndFileName(t *testing.T) {
+	for fullFilePath, name := range map[string]string{
+		"/home/foo/go/src/mymod/main.go":    "mymod/main.go",
+		`C:\Users\foo\go\src\mymod\main.go`: "mymod/main.go",
+		`C:/Users/foo/go/src/mymod\main.go`: "mymod/main.go",
+	} {
+		if n := moduleAndFileName(fullFilePath); n != name {
+			t.Fatalf("Name for %s should be %s, but is %s", fullFilePath, name, n)
+		}
+	}
+}
+
+// TestSetSourceTrim checks that source paths are shown relative to the prefix.
+func TestSetSourceTrim(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	_, file, _, _ := runtime.Caller(0)
+	dir, parent := path.Dir(file), path.Dir(path.Dir(file))
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+	defer SetSourceTrim("")
+
+	for _, test := range []struct {
+		prefix string
+		file   string
+	}{
+		{"", path.Base(dir) + "/caller_test.go"},
+		{dir, "caller_test.go"},
+		{parent + "/", path.Base(dir) + "/caller_test.go"},
+		{"/nonexistent", path.Base(dir) + "/caller_test.go"},
+		{dir[:len(dir)-1], path.Base(dir) + "/caller_test.go"},
+	} {
+		SetSourceTrim(test.prefix)
+		if site, _ := getCaller(0); site.file != test.file {
+			t.Fatalf("File for prefix '%s' should be %s, but is %s", test.prefix, test.file, site.file)
+		}
+	}
+	SetSourceTrim(`C:\src\mymod`)
+	if name := sourceFileName(`C:\src\mymod\pkg\main.go`); name != "pkg/main.go" {
+		t.Fatalf("Incorrect trimmed name for Windows path: %s", name)
+	}
+}
+
+// TestSetCallerPosition checks that the caller info can be shown at the end of
+// the line.
+func TestSetCallerPosition(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetCallerPosition("prefix")
+
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+	if err := SetCallerPosition("middle"); err == nil {
+		t.Fatal("Illegal position should have been rejected")
+	}
+	if err := SetCallerPosition("suffix"); err != nil {
+		t.Fatal(err)
+	}
+
+	Info("Test Info", F("key", 1))
+	pc, fullFilePath, line, _ := runtime.Caller(0)
+	callerInfo := fmt.Sprintf("[%d %s:%d (%s)]", os.Getpid(),
+		moduleAndFileName(fullFilePath), line-1, runtime.FuncForPC(pc).Name())
+
+	checkLines := []string{"INFO     : Test Info key=1 " + callerInfo}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetCallerFields checks that only the selected components of the caller
+// info are logged.
+func TestSetCallerFields(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetCallerFields(nil)
+
+	conf.showCallerInfo = "true"
+	conf.callerFields = "file, line"
+	initialize(conf, true)
+	Info("Test Info")
+	pc, fullFilePath, line, _ := runtime.Caller(0)
+	if err := SetCallerFields([]string{"func", "class"}); err == nil {
+		t.Fatal("Unknown caller field should have been rejected")
+	}
+	if err := SetCallerFields([]string{"func"}); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info 2")
+
+	checkLines := []string{
+		fmt.Sprintf("INFO     : [%d %s:%d] Test Info", os.Getpid(),
+			path.Base(fullFilePath), line-1),
+		fmt.Sprintf("INFO     : [%d (%s)] Test Info 2", os.Getpid(),
+			runtime.FuncForPC(pc).Name()),
+	}
+	fileMatch(t, checkLines, "")
+}
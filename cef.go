@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Translation from level string to the CEF severity, from 0 (lowest) to 10
+// (highest).
+var cefSeverities = map[string]int{
+	"CRITICAL": 10,
+	"ERROR":    7,
+	"WARN":     5,
+	"INFO":     3,
+	"DEBUG":    1,
+	"TRACE":    0,
+}
+
+// Escapes the characters, which have to be escaped in CEF header fields and in
+// extension values. Line breaks aren't allowed in header fields at all.
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// CEFFormatter formats log records in the ArcSight Common Event Format (CEF),
+// for security information and event management systems:
+//
+//	CEF:0|Vendor|Product|Version|Signature ID|Name|Severity|Extension
+//
+// The level is used as signature ID and mapped to the CEF severity. The
+// message is the name. The extension contains the time as 'rt', in
+// milliseconds since the epoch, followed by caller information (if enabled),
+// trace level, application version, sequence number and the fields of the
+// message, in alphabetical order.
+type CEFFormatter struct {
+	Vendor  string // vendor of the product, which logs
+	Product string // name of the product, which logs
+	Version string // version of the product, if empty the one set via SetVersion() is used
+}
+
+// Format renders the record as CEF message.
+func (f CEFFormatter) Format(r Record) string {
+	version := f.Version
+	if version == "" {
+		version = r.Version
+	}
+
+	var ext bytes.Buffer
+	writeCEFPair(&ext, "rt", strconv.FormatInt(r.Time.UnixNano()/1e6, 10))
+	if r.File != "" {
+		writeCEFPair(&ext, "file", r.File)
+	}
+	if r.Line != 0 {
+		writeCEFPair(&ext, "line", r.Line)
+	}
+	if r.Func != "" {
+		writeCEFPair(&ext, "func", r.Func)
+	}
+	if r.TraceLevel != notATrace {
+		writeCEFPair(&ext, "trace_level", r.TraceLevel)
+	}
+	if r.Version != "" {
+		writeCEFPair(&ext, "version", r.Version)
+	}
+	if r.Seq != 0 {
+		writeCEFPair(&ext, "seq", r.Seq)
+	}
+	if r.TimeSeq != 0 {
+		writeCEFPair(&ext, "time_seq", r.TimeSeq)
+	}
+	for _, k := range r.Fields.sortedKeys() {
+		writeCEFPair(&ext, k, r.Fields[k])
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(f.Vendor), cefHeaderEscaper.Replace(f.Product),
+		cefHeaderEscaper.Replace(version), cefHeaderEscaper.Replace(r.Level),
+		cefHeaderEscaper.Replace(r.Message), cefSeverities[r.severity()], ext.String())
+}
+
+// writeCEFPair appends a key/value pair to a CEF extension, separated from the
+// previous one by a space. Keys may only contain letters, digits and '_',
+// other characters are replaced by '_'.
+func writeCEFPair(buf *bytes.Buffer, key string, value interface{}) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, key))
+	buf.WriteByte('=')
+	buf.WriteString(cefExtensionEscaper.Replace(fmt.Sprint(value)))
+}
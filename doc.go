@@ -22,7 +22,9 @@
 // • A new config file can be specified and applied programmatically at any time.
 //
 // • Offers familiar and easy to use log functions for the usual levels: Debug,
-// Info, Warn, Error and Critical.
+// Info, Warn, Error and Critical. Fatal logs a critical message and then exits
+// the program. WarnEvery and friends log at most one message per call site
+// within a given duration.
 //
 //
 // • Offers an additional multi level logging facility with arbitrary depth,
@@ -59,6 +61,11 @@
 // or file can be specified from within your programs at any time.
 //
 //
+// • Output can optionally be formatted by a pluggable formatter, for example as
+// GELF messages for direct ingestion by Graylog, as RFC5424 syslog messages
+// with structured data, as CEF events for SIEM systems, or in logfmt style.
+//
+//
 // Defaults
 //
 // Rlog comes with reasonable defaults, so you can just start using it without any
@@ -86,12 +93,20 @@
 //
 //
 // • RLOG_LOG_LEVEL: Set to "DEBUG", "INFO", "WARN", "ERROR", "CRITICAL" or
-// "NONE". Any message of a level >= than what's configured will be printed. If
-// this is not defined it will default to "INFO". If it is set to "NONE" then
-// all logging is disabled, except Trace logs, which are controlled via a
-// separate variable. In addition, log levels can be set for individual files
-// (see below for more information). Default: INFO - meaning that INFO and
-// higher is logged.
+// "NONE". Any message, which is at least as severe as the configured level,
+// will be printed. For example, with "WARN" the levels WARN, ERROR and CRITICAL
+// are printed, but INFO and DEBUG are not. If this is not defined it will
+// default to "INFO". If it is set to "NONE" then all logging is disabled,
+// except Trace logs, which are controlled via a separate variable. In addition,
+// log levels can be set for individual files (see below for more information).
+// Default: INFO - meaning that INFO and higher is logged.
+//
+//
+// • RLOG_DEFAULT_LOG_LEVEL: The global log level, which is used if none is
+// specified in RLOG_LOG_LEVEL. This accepts the same values as RLOG_LOG_LEVEL,
+// but no per-file levels. It can also be set from within your program with the
+// SetDefaultLogLevel() function, for example by libraries that want a quieter
+// default. Default: INFO.
 //
 //
 // • RLOG_TRACE_LEVEL: "Trace" log messages take an additional numeric level as
@@ -101,8 +116,12 @@
 // then no Trace messages are printed. The idea is that the higher the
 // RLOG_TRACE_LEVEL value, the more 'chatty' and verbose the Trace message
 // output becomes. In addition, trace levels can be set for individual files
-// (see below for more information). Default: Not set - meaning that no trace
-// messages are logged.
+// (see below for more information). Trace levels range from 0 to 1000. A
+// Trace message with a level outside of that range is logged with the nearest
+// level in the range, and a higher RLOG_TRACE_LEVEL means 1000. Instead of a
+// number, "ALL" or "MAX" can be used for 1000, and "OFF" or "NONE" for -1, also
+// for individual files. Default: Not set - meaning that no trace messages are
+// logged.
 //
 //
 // • RLOG_CALLER_INFO: If this variable is set to "1", "yes" or something else
@@ -112,6 +131,13 @@
 // info is logged.
 //
 //
+// • RLOG_CALLER_FIELDS: A comma separated list of the components of the caller
+// info, which are logged: "module", "file", "line" and "func". For example,
+// "file,line" shows just the file name and line number. The same applies to the
+// caller info passed to formatters. This can also be changed via
+// SetCallerFields(). Default: Not set - meaning that all components are logged.
+//
+//
 // • RLOG_GOROUTINE_ID: If this variable is set to "1", "yes" or something else
 // that evaluates to 'true' AND the printing of caller info is requested, then
 // the caller info contains the goroutine ID, separated from the process ID by a
@@ -119,12 +145,22 @@
 // please only enable this option if needed.
 //
 //
+// • RLOG_SKIP_PACKAGES: A comma separated list of packages, for example
+// "mycompany/logutil". If you wrap rlog in helper packages, log messages would
+// normally be attributed to those helpers. With this setting, rlog walks up
+// the stack and attributes each message to the first caller outside of the
+// listed packages. This affects the caller info as well as per-file log and
+// trace levels. Default: Not set - meaning that the direct caller of the rlog
+// function is used.
+//
+//
 // • RLOG_TIME_FORMAT: Use this variable to customize the date/time format. The
 // format is specified either by the well known formats listed in
 // https://golang.org/src/time/format.go (https://golang.org/src/time/format.go), for example "UnixDate" or "RFC3339".
 // Or as an example date/time output, which is described here:
-// https://golang.org/pkg/time/#Time.Format (https://golang.org/pkg/time/#Time.Format) Default: Not set - formatted
-// according to RFC3339.
+// https://golang.org/pkg/time/#Time.Format (https://golang.org/pkg/time/#Time.Format) The special value "TimeOnly" logs
+// just the time of day with milliseconds ("15:04:05.000"), which is handy for
+// short running tools. Default: Not set - formatted according to RFC3339.
 //
 //
 // • RLOG_LOG_NOTIME: If this variable is set to "1", "yes" or something else
@@ -140,14 +176,94 @@
 // file.
 //
 //
-// • RLOG_LOG_STREAM: Use this to direct the log output to a different output
-// stream, instead of stderr. This accepts three values: "stderr", "stdout" or
-// "none". If either stderr or stdout is defined here AND a logfile is specified
-// via RLOG_LOG_FILE then the output is sent to both. Default: Not set -
-// meaning the output goes to stderr.
+// • RLOG_LOG_FILE_BUFFER_KB: The size of a buffer for the logfile, in KB. With
+// a buffer, log output is written to the logfile in larger blocks, at least
+// once per second, which improves throughput. The interval can be changed
+// with the SetFlushInterval() function. However, buffered messages are
+// lost if the program crashes, so they may be missing exactly when they are
+// needed most. The buffer can be written out with the Flush() function, for
+// example before the program exits. RegisterExitFlush() does this when the
+// program is terminated by SIGINT or SIGTERM. Default: 0 - meaning that each
+// message is written to the logfile right away.
 //
 //
-// There are two more settings, related to the configuration file, which can only
+// • RLOG_LOG_STREAM: Use this to direct the log output to a different output
+// stream, instead of stderr. This accepts the values "stderr", "stdout",
+// "syslog", "none" or "discard". With "syslog" the output is sent to the system
+// logger, with the INFO priority of the user facility. The values "none" and
+// "discard" both switch off the stream output. An unknown value causes a warning
+// and stderr is used. If a stream is defined here AND a logfile is specified via
+// RLOG_LOG_FILE then the output is sent to both. Default: Not set - meaning the
+// output goes to stderr.
+//
+//
+// • RLOG_SPLIT_STREAMS: If this variable is set to "1", "yes" or something else
+// that evaluates to 'true' then warnings and more severe messages are sent to
+// stderr, while all other messages are sent to stdout. This follows the Unix
+// convention and allows shell pipelines to separate normal output from
+// diagnostics. It takes precedence over RLOG_LOG_STREAM, unless that is set to
+// "syslog", "none" or "discard". Default: No - meaning that all messages go
+// to the same stream.
+//
+//
+// • RLOG_STRICT: If this variable is set to "1", "yes" or something else that
+// evaluates to 'true' then rlog warns on stderr if the configuration disables
+// all log output, for example because RLOG_LOG_STREAM is set to "none" and no
+// logfile is specified. This helps to find out why there are no logs. Default:
+// No - meaning that rlog silently accepts a configuration without any output.
+//
+//
+// • RLOG_SIGUSR1_CYCLE: If this variable is set to "1", "yes" or something else
+// that evaluates to 'true' then each SIGUSR1 sent to the process moves the
+// global log level on to the next one in the cycle WARN, INFO, DEBUG, TRACE
+// and back to WARN. TRACE means DEBUG plus all trace messages. The new level
+// is printed to stderr. This allows quick debugging in the field, for example
+// with "kill -USR1 <pid>". The cycle starts at the global log level in effect.
+// The level set via SIGUSR1 replaces the global level of RLOG_LOG_LEVEL, also
+// when the config file is read again, while filters for individual files
+// remain. It is only read from the environment, not from the config file, and
+// is only supported on Unix-like systems. Default: No - meaning that SIGUSR1 is
+// not handled by rlog.
+//
+//
+// • RLOG_SIGHUP_REOPEN: If this variable is set to "1", "yes" or something else
+// that evaluates to 'true' then the logfile is closed and opened again whenever
+// the process receives SIGHUP. This is what logrotate and similar tools expect
+// after renaming the logfile. Programs can do the same by calling
+// ReopenLogFile(). It is only read from the environment, not from the config
+// file, and is only supported on Unix-like systems. Default: No - meaning that
+// SIGHUP is not handled by rlog.
+//
+//
+// • RLOG_SHOW_HOSTNAME: If this variable is set to "1", "yes" or something else
+// that evaluates to 'true' then the host name is logged with each message,
+// enclosed in square brackets after the date/time stamp. This is useful when
+// the logs of many hosts are collected centrally. Default: No - meaning that
+// the host name is not logged.
+//
+//
+// • RLOG_HOSTNAME: The host name to log, if the kernel's host name isn't
+// meaningful in your deployment. Default: Not set - meaning that the host name
+// reported by the operating system is used.
+//
+//
+// • RLOG_LEVEL_NUMERIC: If this variable is set to "1", "yes" or something else
+// that evaluates to 'true' then the log level is shown as a number, rather than
+// by its name. These are the numbers used by rlog internally, from 1 for
+// CRITICAL to 6 for TRACE. If set to "syslog" then the syslog severities are
+// shown instead, from 2 for CRITICAL to 7 for DEBUG and TRACE. Default: No -
+// meaning that the names of the levels are shown.
+//
+//
+// • RLOG_SHOW_SEQ: If this variable is set to "1", "yes" or something else that
+// evaluates to 'true' then each logged message gets a sequence number, which
+// is shown with a '#' at the start of the line. Sequence numbers are counted
+// per process and only for messages that are actually logged, so a gap in the
+// sequence means that messages got lost downstream. Default: No - meaning that
+// no sequence numbers are logged.
+//
+//
+// There are three more settings, related to the configuration file, which can only
 // be set via environment variables.
 //
 //
@@ -157,6 +273,10 @@
 // file in "/etc/rlog/your-executable-name.conf". Therefore, by default every
 // executable has its own config file. By setting this variable, you could
 // force multiple processes to share the same config file.
+// Several config files may be listed, separated by commas or colons (semicolons
+// on Windows), for example a base config and an environment specific one. They
+// are read in order, and a setting in a later file replaces the same setting
+// of an earlier file, including its '!' prefix. Missing files are skipped.
 // Note that with the SetConfFile() function you can specify a new config file
 // programmatically at any time, even with a relative path.
 //
@@ -171,6 +291,12 @@
 // to 0 in order to switch off the regular config file checking: The config file
 // will then only be read once at the start.
 //
+// • RLOG_CONFIG_ALLOW_OVERRIDE: If this flag is set to false ("0", "no", ...),
+// a '!' prefix in the config file doesn't give a setting priority over the
+// environment variables. Such settings are applied as if the '!' was missing,
+// and a warning is printed. This ensures that the environment variables always
+// win. Default: Yes - meaning that '!' overrides the environment variables.
+//
 //
 // Please note! If these environment variables have incorrect or misspelled
 // values then they will be silently ignored and a default value will be used.
@@ -219,6 +345,13 @@
 // function.
 //
 //
+// Settings in the same format can also be read from any io.Reader via the
+// LoadConfig() function, for example from a string or an embedded asset. They
+// are combined with the environment variables just like the content of a config
+// file, which comes before the files in RLOG_CONF_FILE, so these may replace
+// them. They stay in effect until LoadConfig() is called again.
+//
+//
 // Logfile format
 //
 // The format of the logfile is simple. Each setting is referred to by the same
@@ -243,6 +376,9 @@
 //
 // • Spaces or further '=' characters within values are taken as they are.
 //
+// • If a setting appears more than once, the first one is used, unless a
+// later one is prefixed with '!'.
+//
 // Combining configuration from environment variables and config file
 //
 // Generally, environment variables take precedence. Assume you have set a log
@@ -271,6 +407,17 @@
 //   !RLOG_TIME_FORMAT=UnixDate
 //   RLOG_LOG_FILE=/var/log/myapp.log
 //
+// Flags, such as RLOG_CALLER_INFO, are either set to true ("1", "yes", "on",
+// ...), to false ("0", "no", "off", ...), or not set at all. A flag with any
+// other value counts as not set. Therefore, an environment variable that
+// explicitly switches a flag off is respected just like one that switches it on,
+// and a config file entry like "!RLOG_CALLER_INFO=false" switches off a flag that
+// was enabled in the environment.
+//
+// If RLOG_CONFIG_ALLOW_OVERRIDE is set to false, only the first case applies:
+// The config file can then only provide values that are not set in the
+// environment variables, with or without a '!'.
+//
 // Per file level log and trace levels
 //
 // In most cases you might want to set just a single log or trace level, which is
@@ -329,6 +476,44 @@
 // trace level.
 //
 //
+// Instead of a file, a filter may also name a function by prefixing the pattern
+// with 'func:'. The pattern is matched against the name of the calling function
+// without its package, for example 'HandleLogin' or '(*Server).HandleLogin'.
+// This allows for finer grained control than per-file filtering alone:
+//
+//   # Trace level 5 only within the HandleLogin function.
+//   export RLOG_TRACE_LEVEL=func:HandleLogin=5
+//
+//
+// A filter may also name a package by prefixing the pattern with 'pkg:'. Then
+// the level applies to all files of the package of the calling function. The
+// pattern is matched against the last element of the import path, for example
+// 'auth', or against the full import path if the pattern contains a '/':
+//
+//   # Debug messages for the auth package and the packages in myapp/store.
+//   export RLOG_LOG_LEVEL=pkg:auth=DEBUG,pkg:github.com/me/myapp/store/*=DEBUG
+//
+// Filtering policies, which can't be expressed with patterns, can be implemented
+// by a function set via SetFilterFunc() or SetTraceFilterFunc(). It is asked
+// first and decides on its own, if it reports a match. Otherwise, the filters
+// from the environment variables or the config file decide as usual.
+//
+//
+// Compiling out caller lookups
+//
+// Determining the caller of a log function (via runtime.Caller) is the single
+// biggest cost of a log message. If you only ever use a single, global log and
+// trace level and don't need caller info, you can build your program with the
+// 'rlog_nocaller' build tag:
+//
+//   go build -tags rlog_nocaller
+//
+// This removes all caller lookups, so that logging is as fast as possible. The
+// tradeoff: Per-file and per-function log and trace levels are no longer
+// available, only the global levels are applied. If RLOG_CALLER_INFO is set, the
+// caller is shown as 'unknown'.
+//
+//
 // Usage example
 //
 //   import "github.com/romana/rlog"
@@ -345,6 +530,13 @@
 //
 // For a more interesting example, please check out 'examples/example.go'.
 //
+// The arguments of the log functions are formatted as by fmt.Sprintln, those of
+// the functions ending in 'f' as by fmt.Sprintf. A nil argument is shown as
+// '<nil>', and so is a nil pointer, whose String() or Error() method panics,
+// for example a nil error of a pointer type. If such a method panics for any
+// other argument, the message is still logged, with
+// '%!v(PANIC=String method: ...)' in place of the argument.
+//
 // Sample output
 //
 // With time stamp, trace to level 2, log level WARNING, no caller info:
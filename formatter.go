@@ -0,0 +1,170 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// Record holds everything rlog knows about a single log message. It is handed
+// to a Formatter, which turns it into a line of log output. The caller
+// information (File, Line and Func) is only set if caller info is enabled via
+// RLOG_CALLER_INFO and could be determined, otherwise it is left empty. The
+// same applies to the components, which weren't selected via
+// RLOG_CALLER_FIELDS.
+type Record struct {
+	Time       time.Time // time at which the message was logged
+	Level      string    // name of the log level, for example "INFO" or "TRACE"
+	TraceLevel int       // level of a trace message, -1 for other messages
+	File       string    // module and file name of the caller
+	Line       int       // line number of the caller
+	Func       string    // name of the calling function
+	Message    string    // the message itself, without trailing newline
+	Version    string    // application version set via SetVersion(), if any
+	Fields     Fields    // additional fields of this message, if any
+	Seq        uint64    // sequence number, if enabled via RLOG_SHOW_SEQ, else 0
+	TimeSeq    uint64    // number within the time stamp, if enabled via SetTimeSeq()
+
+	level int // number of the level, which the message was filtered with
+}
+
+// severity returns the name of the level, which determines the severity of
+// the record in the structured formats. For an unknown level, which is shown
+// with the name set via SetUnknownLevelName(), this is the level it was
+// filtered with. Records without a valid level are treated as INFO.
+func (r Record) severity() string {
+	if _, ok := levelNumbers[r.Level]; ok && r.Level != "NONE" {
+		return r.Level
+	}
+	if r.level != levelNone {
+		if name, ok := levelStrings[r.level]; ok {
+			return name
+		}
+	}
+	return "INFO"
+}
+
+// Fields are additional key/value pairs, which are logged with a message. In
+// the text output they are appended to the message as 'key=value'. Fields are
+// always output in alphabetical order of their keys, by all of rlog's
+// formatters, so that log output is reproducible.
+type Fields map[string]interface{}
+
+// Field is a single key/value pair, which is logged with a message. Fields are
+// created with F() and can be passed to any of the log functions, in addition
+// to the normal arguments. They are not part of the message itself, nor are
+// they used for the format string of the formatting log functions:
+//
+//	rlog.Infof("Login of %s", name, rlog.F("user", id), rlog.F("action", act))
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field with the given key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// ExtraOutput is an additional destination for a single log message. It's
+// created with ToWriter().
+type ExtraOutput struct {
+	w io.Writer
+}
+
+// ToWriter returns an argument for the log functions, which writes the message
+// to the given writer as well, in addition to the configured outputs. Like the
+// fields created with F() it's not part of the message. This is useful to send
+// an individual message somewhere else, without changing the configuration:
+//
+//	rlog.Critical("Admin password changed", rlog.ToWriter(auditFile))
+//
+// The message is written in its final form, including fields, prefixes and the
+// selected Formatter, and only if it passes the log and trace level filters.
+// Writes to the writer aren't serialized by rlog and errors are ignored.
+func ToWriter(w io.Writer) ExtraOutput {
+	return ExtraOutput{w: w}
+}
+
+// sortedKeys returns the keys of the fields in alphabetical order.
+func (f Fields) sortedKeys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Formatter turns a log record into a line of log output. A formatter for the
+// log output can be selected with SetFormatter().
+type Formatter interface {
+	Format(r Record) string
+}
+
+// settingFormatter is the formatter selected via SetFormatter(). If it is nil,
+// rlog's own text format is used.
+var settingFormatter Formatter
+
+// settingJSONPretty determines whether JSON output is indented.
+var settingJSONPretty bool
+
+// settingJSONSchemaVersion is the schema version set via
+// SetJSONSchemaVersion().
+var settingJSONSchemaVersion string
+
+// SetFormatter selects the formatter for all log output. Passing nil restores
+// rlog's default text format.
+func SetFormatter(f Formatter) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingFormatter = f
+}
+
+// SetJSONPretty determines whether formatters that produce JSON, such as the
+// GELFFormatter, indent their output. By default, each message is a single
+// line of compact JSON. Pretty JSON spans multiple lines, which breaks line
+// oriented log shippers, so it is meant for human reading only, for example
+// during local development.
+func SetJSONPretty(pretty bool) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingJSONPretty = pretty
+}
+
+// SetJSONSchemaVersion sets a schema version, which formatters that produce
+// JSON, such as the GELFFormatter, include in every message. This allows the
+// consumers of long lived log archives to tell which layout a message follows,
+// if that changes over time. The GELFFormatter adds it as '_schema' field. An
+// empty version, which is the default, leaves the field out.
+func SetJSONSchemaVersion(version string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingJSONSchemaVersion = version
+}
+
+// marshalJSON is used by the JSON based formatters and produces compact or
+// indented JSON, as selected via SetJSONPretty(). The keys of maps are sorted
+// by the json package, so fields are always in alphabetical order.
+func marshalJSON(v interface{}) ([]byte, error) {
+	if settingJSONPretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
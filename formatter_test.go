@@ -0,0 +1,315 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readJSONLines reads the logfile and decodes each line as a JSON object.
+func readJSONLines(t *testing.T) []map[string]interface{} {
+	content, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			t.Fatalf("Cannot decode log line '%s': %s", line, err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// TestGELFFormatter checks that log messages are output in GELF format, with
+// the levels mapped to syslog severities.
+func TestGELFFormatter(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "2"
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+	SetFormatter(GELFFormatter{Host: "testhost"})
+	defer SetFormatter(nil)
+
+	before := float64(time.Now().Unix())
+	Warn("Test Warning")
+	Tracef(2, "Trace %d", 2)
+
+	objs := readJSONLines(t)
+	if len(objs) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d", len(objs))
+	}
+	checks := []map[string]interface{}{
+		{
+			"version":       "1.1",
+			"host":          "testhost",
+			"short_message": "Test Warning",
+			"level":         float64(4),
+		},
+		{
+			"short_message": "Trace 2",
+			"level":         float64(7),
+			"_trace_level":  float64(2),
+		},
+	}
+	if file, _ := objs[0]["_file"].(string); callerLookupEnabled && !strings.HasSuffix(file, "/formatter_test.go") {
+		t.Fatalf("Incorrect caller file '%s'", file)
+	}
+	for i, check := range checks {
+		for k, v := range check {
+			if objs[i][k] != v {
+				t.Fatalf("Line %d: Field '%s' should be '%v', but is '%v'", i, k, v, objs[i][k])
+			}
+		}
+		if ts, _ := objs[i]["timestamp"].(float64); ts < before {
+			t.Fatalf("Line %d: Incorrect timestamp %v", i, objs[i]["timestamp"])
+		}
+	}
+}
+
+// TestGELFFormatterNoCaller checks that caller fields are left out if no
+// caller information is available.
+func TestGELFFormatterNoCaller(t *testing.T) {
+	line := GELFFormatter{Host: "testhost"}.Format(Record{
+		Time:       time.Now(),
+		Level:      "INFO",
+		TraceLevel: notATrace,
+		Message:    "Test Info",
+	})
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"_file", "_line", "_func", "_trace_level"} {
+		if _, ok := obj[k]; ok {
+			t.Fatalf("Field '%s' should not be present in '%s'", k, line)
+		}
+	}
+}
+
+// TestSetJSONPretty checks that JSON output can be indented.
+func TestSetJSONPretty(t *testing.T) {
+	r := Record{Time: time.Now(), Level: "INFO", TraceLevel: notATrace, Message: "Test Info"}
+
+	SetJSONPretty(true)
+	line := GELFFormatter{}.Format(r)
+	SetJSONPretty(false)
+	if !strings.Contains(line, "\n  \"short_message\": \"Test Info\"") {
+		t.Fatalf("JSON output should be indented: %s", line)
+	}
+	if line = (GELFFormatter{}).Format(r); strings.Contains(line, "\n") {
+		t.Fatalf("JSON output should be compact: %s", line)
+	}
+}
+
+// TestSetJSONSchemaVersion checks that the schema version is only included in
+// JSON output if it's set.
+func TestSetJSONSchemaVersion(t *testing.T) {
+	r := Record{Time: time.Now(), Level: "INFO", TraceLevel: notATrace, Message: "Test Info"}
+
+	SetJSONSchemaVersion("2")
+	line := GELFFormatter{}.Format(r)
+	SetJSONSchemaVersion("")
+	if !strings.Contains(line, `"_schema":"2"`) {
+		t.Fatalf("JSON output should contain the schema version: %s", line)
+	}
+	if line = (GELFFormatter{}).Format(r); strings.Contains(line, "_schema") {
+		t.Fatalf("JSON output should not contain a schema version: %s", line)
+	}
+}
+
+// TestRFC5424Formatter checks the header and the structured data of RFC5424
+// messages.
+func TestRFC5424Formatter(t *testing.T) {
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	f := RFC5424Formatter{Host: "testhost", AppName: "my app", MsgID: "ID1"}
+
+	line := f.Format(Record{
+		Time:       ts,
+		Level:      "WARN",
+		TraceLevel: notATrace,
+		Message:    "Test Warning",
+		Fields:     Fields{"user": `a"b]c`, "bad key": 1},
+	})
+	should := fmt.Sprintf(`<12>1 2017-03-04T05:06:07.123456Z testhost my_app %d ID1 `+
+		`[rlog@32473 bad_key="1" user="a\"b\]c"] Test Warning`, os.Getpid())
+	if line != should {
+		t.Fatalf("Incorrect message:\n%s\nShould be:\n%s", line, should)
+	}
+
+	f = RFC5424Formatter{Facility: 16, Host: "testhost", AppName: "app"}
+	line = f.Format(Record{
+		Time:       ts,
+		Level:      "TRACE",
+		TraceLevel: 2,
+		Message:    "Trace 2",
+	})
+	should = fmt.Sprintf(`<135>1 2017-03-04T05:06:07.123456Z testhost app %d - `+
+		`[rlog@32473 trace_level="2"] Trace 2`, os.Getpid())
+	if line != should {
+		t.Fatalf("Incorrect message:\n%s\nShould be:\n%s", line, should)
+	}
+
+	line = f.Format(Record{Time: ts, Level: "INFO", TraceLevel: notATrace, Message: "Test Info"})
+	if !strings.HasSuffix(line, " - - Test Info") {
+		t.Fatalf("Incorrect message without structured data: %s", line)
+	}
+}
+
+// TestLogfmtFormatter checks that records are rendered as logfmt pairs, with
+// quotes where needed.
+func TestLogfmtFormatter(t *testing.T) {
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	f := LogfmtFormatter{}
+
+	line := f.Format(Record{
+		Time:       ts,
+		Level:      "WARN",
+		TraceLevel: notATrace,
+		File:       "rlog/main.go",
+		Line:       12,
+		Func:       "main.main",
+		Message:    "Test Warning",
+		Fields:     Fields{"user": `a "b"`, "bad key": 1, "empty": ""},
+	})
+	should := `time=2017-03-04T05:06:07.123Z level=WARN caller=rlog/main.go:12 ` +
+		`func=main.main msg="Test Warning" bad_key=1 empty="" user="a \"b\""`
+	if line != should {
+		t.Fatalf("Incorrect message:\n%s\nShould be:\n%s", line, should)
+	}
+
+	f = LogfmtFormatter{TimeFormat: "15:04"}
+	line = f.Format(Record{Time: ts, Level: "TRACE", TraceLevel: 2, Message: "x=1\ny"})
+	should = `time=05:06 level=TRACE trace_level=2 msg="x=1\ny"`
+	if line != should {
+		t.Fatalf("Incorrect message:\n%s\nShould be:\n%s", line, should)
+	}
+}
+
+// TestCEFFormatter checks the header and the escaped extension of CEF
+// messages.
+func TestCEFFormatter(t *testing.T) {
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	f := CEFFormatter{Vendor: "Acme", Product: "a|b", Version: "1.0"}
+
+	line := f.Format(Record{
+		Time:       ts,
+		Level:      "ERROR",
+		TraceLevel: notATrace,
+		Message:    `Login failed\|`,
+		Fields:     Fields{"user": `a=b\c`, "bad key": "x\ny"},
+	})
+	should := `CEF:0|Acme|a\|b|1.0|ERROR|Login failed\\\||7|rt=1488603967123 ` +
+		`bad_key=x\ny user=a\=b\\c`
+	if line != should {
+		t.Fatalf("Incorrect message:\n%s\nShould be:\n%s", line, should)
+	}
+
+	f = CEFFormatter{Vendor: "Acme", Product: "app"}
+	line = f.Format(Record{Time: ts, Level: "TRACE", TraceLevel: 2, Message: "Trace 2", Version: "2.1"})
+	should = `CEF:0|Acme|app|2.1|TRACE|Trace 2|0|rt=1488603967123 trace_level=2 version=2.1`
+	if line != should {
+		t.Fatalf("Incorrect message:\n%s\nShould be:\n%s", line, should)
+	}
+}
+
+// recordFormatter keeps the records it is asked to format.
+type recordFormatter struct {
+	records []Record
+}
+
+func (f *recordFormatter) Format(r Record) string {
+	f.records = append(f.records, r)
+	return r.Message
+}
+
+// TestGELFReservedField checks that a field 'id' isn't sent as '_id', which is
+// reserved by GELF.
+func TestGELFReservedField(t *testing.T) {
+	line := GELFFormatter{Host: "testhost"}.Format(Record{
+		Time:       time.Now(),
+		Level:      "INFO",
+		TraceLevel: notATrace,
+		Message:    "Test Info",
+		Fields:     Fields{"id": 42, "user": "x"},
+	})
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := obj["_id"]; ok || obj["_id_"] != float64(42) || obj["_user"] != "x" {
+		t.Fatalf("Incorrect fields in '%s'", line)
+	}
+}
+
+// TestUnknownLevelSeverity checks that messages with an unknown level get the
+// severity of the level they are filtered with, in all structured formats.
+func TestUnknownLevelSeverity(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	initialize(conf, true)
+	f := &recordFormatter{}
+	SetFormatter(f)
+	defer SetFormatter(nil)
+
+	LogLevel(Level(42), "Test Unknown")
+	if len(f.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(f.records))
+	}
+	r := f.records[0]
+	r.Time = time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	if r.Level != "LOG" {
+		t.Fatalf("Incorrect level name '%s'", r.Level)
+	}
+
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(GELFFormatter{Host: "testhost"}.Format(r)), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj["level"] != float64(7) {
+		t.Fatalf("Incorrect GELF level %v", obj["level"])
+	}
+	if line := (RFC5424Formatter{Host: "testhost"}).Format(r); !strings.HasPrefix(line, "<15>1 ") {
+		t.Fatalf("Incorrect RFC5424 priority: %s", line)
+	}
+	if line := (CEFFormatter{Vendor: "Acme", Product: "app"}).Format(r); !strings.Contains(line, "|Test Unknown|1|") {
+		t.Fatalf("Incorrect CEF severity: %s", line)
+	}
+}
+
+// TestFieldOrder checks that fields are always output in alphabetical order.
+func TestFieldOrder(t *testing.T) {
+	fields := Fields{"b": 1, "c": 2, "a": 3, "d": 4}
+	if s := textFields(fields); s != " a=3 b=1 c=2 d=4" {
+		t.Fatalf("Incorrect text fields: '%s'", s)
+	}
+	line := GELFFormatter{Host: "testhost"}.Format(Record{Time: time.Now(), Fields: fields})
+	if !strings.Contains(line, `"_a":3,"_b":1,"_c":2,"_d":4`) {
+		t.Fatalf("Incorrect GELF fields: %s", line)
+	}
+}
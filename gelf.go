@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+// Translation from level string to the numeric syslog severity, which is used
+// as the level in GELF messages.
+var syslogSeverities = map[string]int{
+	"CRITICAL": 2,
+	"ERROR":    3,
+	"WARN":     4,
+	"INFO":     6,
+	"DEBUG":    7,
+	"TRACE":    7,
+}
+
+// GELFFormatter formats log records as GELF (Graylog Extended Log Format)
+// messages, so that the output can be ingested by Graylog directly. Caller
+// information (if enabled), trace levels, the application version and the
+// fields of a message are added as additional fields, which start with '_', as
+// required by the GELF spec. A field 'id' becomes '_id_', since GELF reserves
+// '_id'.
+type GELFFormatter struct {
+	Host string // host name in each message, if empty rlog's host name is used
+}
+
+// gelfFieldName returns the name of the additional field for a field of a
+// message. GELF doesn't allow an additional field named '_id', so a field 'id'
+// is sent as '_id_' instead.
+func gelfFieldName(key string) string {
+	if key == "id" {
+		return "_id_"
+	}
+	return "_" + key
+}
+
+// Format renders the record as GELF message.
+func (f GELFFormatter) Format(r Record) string {
+	host := f.Host
+	if host == "" {
+		host = getHostname()
+	}
+
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": r.Message,
+		"timestamp":     float64(r.Time.UnixNano()) / 1e9,
+		"level":         syslogSeverities[r.severity()],
+	}
+	// Caller information is left out entirely if it's not available, rather
+	// than producing empty fields. The same applies to components, which
+	// weren't selected via RLOG_CALLER_FIELDS.
+	if r.File != "" {
+		msg["_file"] = r.File
+	}
+	if r.Line != 0 {
+		msg["_line"] = r.Line
+	}
+	if r.Func != "" {
+		msg["_func"] = r.Func
+	}
+	if r.TraceLevel != notATrace {
+		msg["_trace_level"] = r.TraceLevel
+	}
+	if r.Version != "" {
+		msg["_version"] = r.Version
+	}
+	if r.Seq != 0 {
+		msg["_seq"] = r.Seq
+	}
+	if r.TimeSeq != 0 {
+		msg["_time_seq"] = r.TimeSeq
+	}
+	if settingJSONSchemaVersion != "" {
+		msg["_schema"] = settingJSONSchemaVersion
+	}
+	for k, v := range r.Fields {
+		msg[gelfFieldName(k)] = v
+	}
+
+	b, err := marshalJSON(msg)
+	if err != nil {
+		rlogIssue("Unable to format GELF message: %s", err)
+		return ""
+	}
+	return string(b)
+}
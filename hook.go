@@ -0,0 +1,212 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// recordHook wraps a function registered via AddRecordHook(), so that it can
+// be identified again when it's removed.
+type recordHook struct {
+	fn func(r Record)
+}
+
+// recordHooks are all currently registered record hooks.
+var recordHooks []*recordHook
+
+// AddRecordHook registers a function, which is called with the record of every
+// log message that passes the log and trace level filters. This allows the
+// structured data of a message to be shipped to a metrics or alerting system.
+// Hooks are called before the message is written, but since the record is
+// passed by value, changes made by the hook don't affect the log output. Note
+// that a hook must not call any rlog log functions itself.
+//
+// The returned function removes the hook again.
+func AddRecordHook(fn func(r Record)) func() {
+	hook := &recordHook{fn: fn}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	recordHooks = append(recordHooks, hook)
+
+	return func() {
+		initMutex.Lock()
+		defer initMutex.Unlock()
+		// Build a new slice, rather than modifying the existing one in place.
+		var hooks []*recordHook
+		for _, h := range recordHooks {
+			if h != hook {
+				hooks = append(hooks, h)
+			}
+		}
+		recordHooks = hooks
+	}
+}
+
+// SubscribeTrace registers a function, which is called with the record of
+// every trace message that passes the trace filters. This allows a debug
+// console or live trace viewer to be attached at runtime, without changing
+// the configured outputs. The same restrictions as for AddRecordHook apply.
+//
+// A subscriber has no trace level of its own: It only sees the trace messages,
+// which are enabled by RLOG_TRACE_LEVEL or EnableTrace(), and these also go to
+// the configured outputs. To see more, raise the trace level as well, for
+// example via EnableTrace() for the duration of the subscription.
+//
+// The returned function removes the subscription again.
+func SubscribeTrace(fn func(r Record)) func() {
+	return AddRecordHook(func(r Record) {
+		if r.TraceLevel != notATrace {
+			fn(r)
+		}
+	})
+}
+
+// Subscribe returns a channel, which receives the record of every log message
+// with the given minimum level or above, which passes the log and trace level
+// filters. Trace messages are included only if minLevel is "TRACE" or empty.
+// This is meant for live log viewers within a program, for example the log
+// pane of a terminal UI. The channel holds up to buffer records.
+//
+// Logging never waits for a subscriber. If the buffer is full, the oldest
+// record in it is dropped to make room, so that a slow subscriber always sees
+// the most recent messages. Dropped records are counted in Metrics().Dropped.
+// An unknown minLevel is reported and then treated like an empty one.
+//
+// The returned function ends the subscription and closes the channel.
+func Subscribe(minLevel string, buffer int) (<-chan Record, func()) {
+	maxLevel := levelTrace
+	if minLevel != "" {
+		level, ok := levelNumbers[strings.ToUpper(minLevel)]
+		if ok && level != levelNone {
+			maxLevel = level
+		} else {
+			rlogIssue("Illegal subscription level '%s'. Subscribing to all messages.", minLevel)
+		}
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan Record, buffer)
+	// The hook may still be called after unsubscribing, for example if it
+	// was brought back by Restore(). The flag makes sure that nothing is sent
+	// to the closed channel then.
+	var (
+		mutex  sync.Mutex
+		closed bool
+	)
+	remove := AddRecordHook(func(r Record) {
+		if !levelEnabled(r.level, maxLevel) {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !closed {
+			sendDropOldest(ch, r)
+		}
+	})
+	return ch, func() {
+		remove()
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// sendDropOldest sends the record to the channel without blocking. If the
+// channel is full, the oldest record is taken out of it and dropped. Since
+// several goroutines may log at the same time, this is repeated until the
+// record fits.
+func sendDropOldest(ch chan Record, r Record) {
+	for {
+		select {
+		case ch <- r:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+			atomic.AddUint64(&droppedCount, 1)
+		default:
+		}
+	}
+}
+
+// The channel set via SetChannelOutput(), and whether sending to it blocks.
+var (
+	channelOutput      chan<- Record
+	channelOutputBlock bool
+)
+
+// SetChannelOutput delivers the record of every log message that passes the
+// log and trace level filters to the given channel, in addition to the normal
+// output. This allows log messages to be processed within the program, for
+// example to show them in a UI, without parsing the formatted text. Use
+// Discard() if the records should only go to the channel.
+//
+// If block is set then logging waits until the record could be sent.
+// Otherwise the record is dropped if the channel is full. Note that with
+// blocking, a consumer that stops reading halts all logging, and that the
+// consumer must not call any rlog functions itself. A nil channel stops the
+// delivery of records.
+func SetChannelOutput(ch chan<- Record, block bool) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	channelOutput = ch
+	channelOutputBlock = block
+}
+
+// copyFields returns a copy of the fields of a record, so that the receiver
+// can't change what's logged.
+func copyFields(fields Fields) Fields {
+	if fields == nil {
+		return nil
+	}
+	c := make(Fields, len(fields))
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
+// callRecordHooks calls all registered hooks with the given record and sends
+// it to the output channel, if any. The caller needs to hold initMutex.
+func callRecordHooks(r Record) {
+	fields := r.Fields
+	for _, h := range recordHooks {
+		// Each hook gets its own copy of the fields.
+		r.Fields = copyFields(fields)
+		h.fn(r)
+	}
+	if channelOutput == nil {
+		return
+	}
+	r.Fields = copyFields(fields)
+	if channelOutputBlock {
+		channelOutput <- r
+		return
+	}
+	select {
+	case channelOutput <- r:
+	default:
+		atomic.AddUint64(&droppedCount, 1)
+	}
+}
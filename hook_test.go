@@ -0,0 +1,240 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAddRecordHook checks that hooks receive the records of all messages that
+// pass the filters, and that they can be removed again.
+func TestAddRecordHook(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "WARN"
+	conf.traceLevel = "2"
+	conf.showCallerInfo = "true"
+	initialize(conf, true)
+
+	var records []Record
+	remove := AddRecordHook(func(r Record) {
+		records = append(records, r)
+		r.Message = "changed"
+	})
+	Info("Test Info")
+	Error("Test Error")
+	Trace(2, "Trace 2")
+	remove()
+	Error("Test Error")
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if r := records[0]; r.Level != "ERROR" || r.Message != "Test Error" || r.TraceLevel != notATrace {
+		t.Fatalf("Incorrect record: %+v", r)
+	}
+	if r := records[1]; r.Level != "TRACE" || r.TraceLevel != 2 {
+		t.Fatalf("Incorrect record: %+v", r)
+	}
+	if callerLookupEnabled && !strings.HasSuffix(records[0].Func, ".TestAddRecordHook") {
+		t.Fatalf("Incorrect caller: %+v", records[0])
+	}
+}
+
+// TestSubscribeTrace checks that subscribers only receive trace records.
+func TestSubscribeTrace(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "2"
+	initialize(conf, true)
+
+	var records []Record
+	unsubscribe := SubscribeTrace(func(r Record) {
+		records = append(records, r)
+	})
+	Info("Test Info")
+	Trace(2, "Trace 2")
+	Trace(3, "Trace 3")
+	unsubscribe()
+	Trace(1, "Trace 1")
+
+	if len(records) != 1 || records[0].Message != "Trace 2" {
+		t.Fatalf("Incorrect records: %+v", records)
+	}
+}
+
+// TestSubscribe checks that subscribers only receive records at or above their
+// level, also for unknown levels, that the oldest records are dropped if the
+// buffer is full, and that the channel is closed when unsubscribing.
+func TestSubscribe(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	conf.traceLevel = "1"
+	initialize(conf, true)
+
+	records, unsubscribe := Subscribe("info", 2)
+	defer unsubscribe()
+	all, unsubscribeAll := Subscribe("", 10)
+	Debug("Test Debug")
+	Info("Test Info")
+	Trace(1, "Trace 1")
+	Warn("Test Warning")
+	Error("Test Error")
+	LogLevel(Level(42), "Test Unknown")
+	unsubscribe()
+	unsubscribe()
+	unsubscribeAll()
+
+	var messages []string
+	for r := range records {
+		messages = append(messages, r.Message)
+	}
+	if strings.Join(messages, ",") != "Test Warning,Test Error" {
+		t.Fatalf("Incorrect records: %v", messages)
+	}
+	messages = nil
+	for r := range all {
+		messages = append(messages, r.Message)
+	}
+	if strings.Join(messages, ",") != "Test Debug,Test Info,Trace 1,Test Warning,Test Error,Test Unknown" {
+		t.Fatalf("Incorrect records: %v", messages)
+	}
+}
+
+// TestSubscribeRestore checks that a subscription, which ended after a
+// snapshot was taken, doesn't break logging once the snapshot is restored.
+func TestSubscribeRestore(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	defer Restore(Snapshot())
+	records, unsubscribe := Subscribe("", 1)
+	s := Snapshot()
+	unsubscribe()
+	Restore(s)
+	Info("Test Info")
+
+	if r, ok := <-records; ok {
+		t.Fatalf("Channel should be closed, but got %+v", r)
+	}
+	fileMatch(t, []string{"INFO     : Test Info"}, "")
+}
+
+// TestSetChannelOutput checks that records are sent to the channel, and dropped
+// if it's full and sending doesn't block.
+func TestSetChannelOutput(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetChannelOutput(nil, false)
+
+	initialize(conf, true)
+	Discard()
+	records := make(chan Record, 1)
+	SetChannelOutput(records, false)
+	Info("Test Info", F("key", 1))
+	Info("Test Info 2")
+	Debug("Test Debug")
+
+	r := <-records
+	if r.Message != "Test Info" || r.Fields["key"] != 1 {
+		t.Fatalf("Incorrect record: %+v", r)
+	}
+	select {
+	case r = <-records:
+		t.Fatalf("Record should have been dropped: %+v", r)
+	default:
+	}
+
+	SetChannelOutput(records, true)
+	done := make(chan bool)
+	go func() {
+		Info("Test Info 3")
+		Info("Test Info 4")
+		done <- true
+	}()
+	for _, expected := range []string{"Test Info 3", "Test Info 4"} {
+		if r = <-records; r.Message != expected {
+			t.Fatalf("Expected message '%s', but got '%s'", expected, r.Message)
+		}
+	}
+	<-done
+}
+
+// TestConcurrentHookLog checks that a goroutine, which is inside a slow hook,
+// doesn't cause the log calls of other goroutines to be dropped.
+func TestConcurrentHookLog(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	entered := make(chan bool)
+	release := make(chan bool)
+	remove := AddRecordHook(func(r Record) {
+		if r.Message == "slow" {
+			entered <- true
+			<-release
+		}
+	})
+	defer remove()
+
+	done := make(chan bool)
+	go func() {
+		Info("slow")
+		done <- true
+	}()
+	<-entered
+	// The hook of the first message is still running, while this one is
+	// logged from another goroutine.
+	Info("fast")
+	close(release)
+	<-done
+
+	checkLines := []string{
+		"INFO     : fast",
+		"INFO     : slow",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestRecursiveLog checks that log calls from within a hook or writer are
+// dropped, rather than causing a deadlock.
+func TestRecursiveLog(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	remove := AddRecordHook(func(r Record) {
+		Info("From hook")
+		Trace(1, "From hook")
+	})
+	Info("Test Info")
+	remove()
+
+	SetOutput(writerFunc(func(p []byte) (int, error) {
+		Error("From writer")
+		return len(p), nil
+	}))
+	Info("Test Info 2")
+	if numLoggingGoroutines != 0 {
+		t.Fatalf("%d goroutines still registered", numLoggingGoroutines)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The default time format of the LogfmtFormatter: RFC3339 with milliseconds.
+const logfmtTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// LogfmtFormatter formats log records in logfmt style, as 'key=value' pairs,
+// which are easy to read and still easy to parse. Each line has the keys time
+// and level, followed by trace_level, caller and func (if available), version,
+// seq (if enabled) and msg, and finally the fields of the message, in
+// alphabetical order. Values are quoted if they are empty or contain spaces,
+// quotes, '=' or non-printable characters.
+type LogfmtFormatter struct {
+	TimeFormat string // time layout, if empty RFC3339 with milliseconds is used
+}
+
+// Format renders the record in logfmt style.
+func (f LogfmtFormatter) Format(r Record) string {
+	timeFormat := f.TimeFormat
+	if timeFormat == "" {
+		timeFormat = logfmtTimeFormat
+	}
+
+	var buf bytes.Buffer
+	writeLogfmtPair(&buf, "time", r.Time.Format(timeFormat))
+	writeLogfmtPair(&buf, "level", r.Level)
+	if r.TraceLevel != notATrace {
+		writeLogfmtPair(&buf, "trace_level", r.TraceLevel)
+	}
+	switch {
+	case r.File != "" && r.Line != 0:
+		writeLogfmtPair(&buf, "caller", r.File+":"+strconv.Itoa(r.Line))
+	case r.File != "":
+		writeLogfmtPair(&buf, "caller", r.File)
+	case r.Line != 0:
+		writeLogfmtPair(&buf, "caller", strconv.Itoa(r.Line))
+	}
+	if r.Func != "" {
+		writeLogfmtPair(&buf, "func", r.Func)
+	}
+	if r.Version != "" {
+		writeLogfmtPair(&buf, "version", r.Version)
+	}
+	if r.Seq != 0 {
+		writeLogfmtPair(&buf, "seq", r.Seq)
+	}
+	if r.TimeSeq != 0 {
+		writeLogfmtPair(&buf, "time_seq", r.TimeSeq)
+	}
+	writeLogfmtPair(&buf, "msg", r.Message)
+	for _, k := range r.Fields.sortedKeys() {
+		writeLogfmtPair(&buf, k, r.Fields[k])
+	}
+	return buf.String()
+}
+
+// writeLogfmtPair appends a key/value pair, separated from the previous one by
+// a space. Characters which aren't allowed in keys are replaced by '_'.
+func writeLogfmtPair(buf *bytes.Buffer, key string, value interface{}) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(strings.Map(func(r rune) rune {
+		if isLogfmtSpecial(r) {
+			return '_'
+		}
+		return r
+	}, key))
+	buf.WriteByte('=')
+	s := fmt.Sprint(value)
+	if s == "" || strings.IndexFunc(s, isLogfmtSpecial) >= 0 {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+// isLogfmtSpecial returns whether a character can't be part of a key or an
+// unquoted value.
+func isLogfmtSpecial(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r)
+}
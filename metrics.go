@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// The counters for Metrics(). They are updated atomically, without holding
+// initMutex.
+var (
+	levelCounts     [levelTrace + 1]uint64 // logged messages per level
+	droppedCount    uint64                 // messages or records dropped by rlog
+	suppressedCount uint64                 // messages throttled or capped
+	outputBytes     [numOutputs]uint64     // bytes written per output
+)
+
+// The outputs, for which the written bytes are counted separately.
+const (
+	outputStream    = iota // stdout, stderr, syslog or the writer of SetOutput()
+	outputFile             // the logfile
+	outputTrace            // the writer of SetTraceOutput()
+	outputErrorFile        // the file of SetErrorFile()
+	numOutputs
+)
+
+// The labels of the outputs, as used by BytesWritten().
+var outputLabels = [numOutputs]string{
+	outputStream:    "stream",
+	outputFile:      "file",
+	outputTrace:     "trace",
+	outputErrorFile: "errorfile",
+}
+
+// LogMetrics is a snapshot of counters about the log output, as returned by
+// Metrics().
+type LogMetrics struct {
+	// Number of logged messages per level name ("TRACE", "DEBUG", "INFO",
+	// "WARN", "ERROR" and "CRITICAL"). Messages, which don't pass the log
+	// and trace filters, aren't counted.
+	Messages map[string]uint64
+
+	// Number of messages, which were dropped by rlog itself, rather than
+	// by the filters: Log calls from within hooks or writers, and records
+	// which didn't fit into a full output channel.
+	Dropped uint64
+
+	// Number of messages, which were suppressed on purpose: Messages of
+	// the throttled log functions, such as WarnEvery(), and messages above
+	// the level set via SetMaxEmittedLevel(), unless they are downgraded.
+	Suppressed uint64
+
+	// Number of bytes written to the stream, logfile and other outputs,
+	// including newlines. A line written to two outputs counts twice.
+	// Records passed to hooks, channels or exporters aren't included.
+	BytesWritten uint64
+}
+
+// Metrics returns the current values of the counters. This allows an
+// application to report on its logging, for example periodically. Each
+// counter is read atomically, but messages, which are logged concurrently,
+// may already be counted in some counters and not yet in others.
+func Metrics() LogMetrics {
+	m := LogMetrics{Messages: make(map[string]uint64, levelTrace)}
+	for level := levelCrit; level <= levelTrace; level++ {
+		m.Messages[levelStrings[level]] = atomic.LoadUint64(&levelCounts[level])
+	}
+	m.Dropped = atomic.LoadUint64(&droppedCount)
+	m.Suppressed = atomic.LoadUint64(&suppressedCount)
+	for output := range outputBytes {
+		m.BytesWritten += atomic.LoadUint64(&outputBytes[output])
+	}
+	return m
+}
+
+// BytesWritten returns the number of bytes written to each output, including
+// newlines, for example to estimate the volume of the logs. The outputs are
+// labeled "stream", "file", "trace" and "errorfile". Outputs, which weren't
+// written to, are reported with 0.
+func BytesWritten() map[string]uint64 {
+	m := make(map[string]uint64, numOutputs)
+	for output, label := range outputLabels {
+		m[label] = atomic.LoadUint64(&outputBytes[output])
+	}
+	return m
+}
+
+// ResetMetrics sets all counters to zero, for example at the start of a new
+// reporting interval or of a test.
+func ResetMetrics() {
+	for level := range levelCounts {
+		atomic.StoreUint64(&levelCounts[level], 0)
+	}
+	atomic.StoreUint64(&droppedCount, 0)
+	atomic.StoreUint64(&suppressedCount, 0)
+	for output := range outputBytes {
+		atomic.StoreUint64(&outputBytes[output], 0)
+	}
+}
+
+// writeOutput writes a line to the logger of an output. The bytes are only
+// counted, if the line was written successfully.
+func writeOutput(logger *log.Logger, output int, line string) error {
+	err := logger.Output(2, line)
+	if err == nil {
+		countBytesWritten(output, line)
+	}
+	return err
+}
+
+// countBytesWritten adds a line, which was written to an output, to the
+// counters. The writer adds a newline, unless the line already ends with one.
+func countBytesWritten(output int, line string) {
+	n := len(line)
+	if n == 0 || line[n-1] != '\n' {
+		n++
+	}
+	atomic.AddUint64(&outputBytes[output], uint64(n))
+}
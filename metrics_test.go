@@ -0,0 +1,95 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestMetrics checks that logged messages, dropped records, suppressed
+// messages and written bytes per output are counted, and that the counters can
+// be reset.
+func TestMetrics(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetChannelOutput(nil, false)
+
+	conf.traceLevel = "1"
+	initialize(conf, true)
+	ResetMetrics()
+	Info("Test Info")
+	Debug("Test Debug")
+	Error("Test Error")
+	Trace(1, "Trace 1")
+	SetChannelOutput(make(chan Record), false)
+	Info("Test Info 2")
+	SetChannelOutput(nil, false)
+	for i := 0; i < 3; i++ {
+		InfoEvery(time.Hour, "Test Info 3")
+	}
+	SetMaxEmittedLevel("WARN", false)
+	Error("Test Error 2")
+	SetMaxEmittedLevel("WARN", true)
+	Error("Test Error 3")
+	SetMaxEmittedLevel("", false)
+
+	m := Metrics()
+	if m.Messages["INFO"] != 3 || m.Messages["ERROR"] != 1 || m.Messages["WARN"] != 1 ||
+		m.Messages["TRACE"] != 1 || m.Messages["DEBUG"] != 0 {
+		t.Fatalf("Incorrect message counts: %v", m.Messages)
+	}
+	if m.Dropped != 1 {
+		t.Fatalf("Expected 1 dropped record, got %d", m.Dropped)
+	}
+	if m.Suppressed != 3 {
+		t.Fatalf("Expected 3 suppressed messages, got %d", m.Suppressed)
+	}
+	// Each line is "LEVEL    : " plus message and newline.
+	expected := uint64(6*(11+1)) + uint64(len("Test Info")+len("Test Error")+
+		len("Trace 1")+len("Test Info 2")+len("Test Info 3")+len("Test Error 3"))
+	if m.BytesWritten != expected {
+		t.Fatalf("Expected %d bytes, got %d", expected, m.BytesWritten)
+	}
+	// Only the logfile is written to.
+	if b := BytesWritten(); b["file"] != expected || b["stream"] != 0 || len(b) != numOutputs {
+		t.Fatalf("Incorrect bytes per output: %v", b)
+	}
+
+	ResetMetrics()
+	m = Metrics()
+	if m.Messages["INFO"] != 0 || m.Dropped != 0 || m.Suppressed != 0 || m.BytesWritten != 0 {
+		t.Fatalf("Metrics weren't reset: %+v", m)
+	}
+}
+
+// TestBytesWrittenError checks that lines, which couldn't be written, aren't
+// counted.
+func TestBytesWrittenError(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	SetOutput(writerFunc(func(p []byte) (int, error) {
+		return 0, errors.New("write failed")
+	}))
+	ResetMetrics()
+	Info("Test Info")
+	if b := BytesWritten(); b["stream"] != 0 {
+		t.Fatalf("Failed write was counted: %v", b)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"time"
+)
+
+// Translation from level string to OpenTelemetry severity number.
+var otelSeverities = map[string]int{
+	"TRACE":    1,
+	"DEBUG":    5,
+	"INFO":     9,
+	"WARN":     13,
+	"ERROR":    17,
+	"CRITICAL": 21,
+}
+
+// OTelLogRecord is an rlog message, converted into the shape of an
+// OpenTelemetry (OTLP) log record.
+type OTelLogRecord struct {
+	Timestamp      time.Time
+	SeverityNumber int    // OpenTelemetry severity number
+	SeverityText   string // rlog level name
+	Body           string
+	Attributes     map[string]interface{}
+}
+
+// OTelExporter exports log records to OpenTelemetry. Since rlog has no
+// external dependencies, it doesn't use the OpenTelemetry SDK itself. Instead,
+// an OTelExporter is a small adapter, which converts the OTelLogRecord into
+// the SDK's log record type and passes it on to an OpenTelemetry logs
+// exporter.
+type OTelExporter interface {
+	Export(r OTelLogRecord) error
+}
+
+// settingOTelExporter is the exporter selected via SetOTelExporter().
+var settingOTelExporter OTelExporter
+
+// SetOTelExporter sets an exporter, to which every log message is handed as
+// OpenTelemetry log record, in addition to the normal log output. Caller info
+// (if enabled), trace levels and fields are passed as attributes. Passing nil stops
+// the export.
+func SetOTelExporter(exporter OTelExporter) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingOTelExporter = exporter
+}
+
+// exportOTel converts a record and hands it to the OpenTelemetry exporter.
+// Export errors are reported as rlog issues.
+func exportOTel(r Record) {
+	otelRecord := OTelLogRecord{
+		Timestamp:      r.Time,
+		SeverityNumber: otelSeverities[r.severity()],
+		SeverityText:   r.Level,
+		Body:           r.Message,
+		Attributes:     map[string]interface{}{},
+	}
+	if r.File != "" {
+		otelRecord.Attributes["code.filepath"] = r.File
+	}
+	if r.Line != 0 {
+		otelRecord.Attributes["code.lineno"] = r.Line
+	}
+	if r.Func != "" {
+		otelRecord.Attributes["code.function"] = r.Func
+	}
+	if r.TraceLevel != notATrace {
+		otelRecord.Attributes["rlog.trace_level"] = r.TraceLevel
+	}
+	if r.Version != "" {
+		otelRecord.Attributes["service.version"] = r.Version
+	}
+	if r.Seq != 0 {
+		otelRecord.Attributes["rlog.seq"] = r.Seq
+	}
+	if r.TimeSeq != 0 {
+		otelRecord.Attributes["rlog.time_seq"] = r.TimeSeq
+	}
+	for k, v := range r.Fields {
+		otelRecord.Attributes[k] = v
+	}
+	if err := settingOTelExporter.Export(otelRecord); err != nil {
+		rlogIssue("Unable to export OpenTelemetry log record: %s", err)
+	}
+}
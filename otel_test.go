@@ -0,0 +1,84 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"testing"
+)
+
+// testOTelExporter collects the exported records.
+type testOTelExporter struct {
+	records []OTelLogRecord
+}
+
+func (e *testOTelExporter) Export(r OTelLogRecord) error {
+	e.records = append(e.records, r)
+	return nil
+}
+
+// TestOTelExporter checks that log messages are converted into OpenTelemetry
+// log records.
+func TestOTelExporter(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logStream = "NONE"
+	conf.logFile = ""
+	conf.traceLevel = "3"
+	initialize(conf, true)
+	exporter := &testOTelExporter{}
+	SetOTelExporter(exporter)
+	defer SetOTelExporter(nil)
+
+	Error("Test Error")
+	Trace(3, "Trace 3")
+
+	if len(exporter.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(exporter.records))
+	}
+	r := exporter.records[0]
+	if r.SeverityNumber != 17 || r.SeverityText != "ERROR" || r.Body != "Test Error" {
+		t.Fatalf("Incorrect record: %+v", r)
+	}
+	r = exporter.records[1]
+	if r.SeverityNumber != 1 || r.Attributes["rlog.trace_level"] != 3 {
+		t.Fatalf("Incorrect record: %+v", r)
+	}
+}
+
+// TestOTelExporterUnknownLevel checks that a message with an unknown level
+// gets the severity of the level it is filtered with.
+func TestOTelExporterUnknownLevel(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logStream = "NONE"
+	conf.logFile = ""
+	conf.logLevel = "DEBUG"
+	initialize(conf, true)
+	exporter := &testOTelExporter{}
+	SetOTelExporter(exporter)
+	defer SetOTelExporter(nil)
+
+	LogLevel(Level(-3), "Test Unknown")
+
+	if len(exporter.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(exporter.records))
+	}
+	if r := exporter.records[0]; r.SeverityNumber != 21 || r.SeverityText != "LOG" {
+		t.Fatalf("Incorrect record: %+v", r)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximum lengths of the header fields of RFC5424 messages.
+const (
+	rfc5424MaxHostname = 255
+	rfc5424MaxAppName  = 48
+	rfc5424MaxMsgID    = 32
+	rfc5424MaxSDName   = 32
+)
+
+// Escapes the characters, which have to be escaped in RFC5424 parameter values.
+var rfc5424ParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// RFC5424Formatter formats log records as syslog messages according to
+// RFC5424, for syslog pipelines, which parse structured data. The rlog level is
+// mapped to the syslog severity in PRI. Caller information (if enabled), trace
+// levels, the application version and the fields of a message are added as
+// parameters of a single structured data element.
+type RFC5424Formatter struct {
+	// The syslog facility. Facility 0 (kernel messages) can't be used by
+	// applications, so the zero value selects 1 (user-level messages).
+	Facility int
+	Host     string // host name in each message, if empty rlog's host name is used
+	AppName  string // application name, if empty the name of the executable is used
+	MsgID    string // type of message, if empty it's left out
+	// ID of the structured data element. Should be a name followed by '@' and
+	// a private enterprise number. If empty, "rlog@32473" is used, which
+	// contains the enterprise number reserved for documentation.
+	SDID string
+}
+
+// Format renders the record as RFC5424 syslog message.
+func (f RFC5424Formatter) Format(r Record) string {
+	facility := f.Facility
+	if facility == 0 {
+		facility = 1
+	}
+	host := f.Host
+	if host == "" {
+		host = getHostname()
+	}
+	appName := f.AppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	sdID := f.SDID
+	if sdID == "" {
+		sdID = "rlog@32473"
+	}
+
+	params := map[string]string{}
+	if r.File != "" {
+		params["file"] = r.File
+	}
+	if r.Line != 0 {
+		params["line"] = strconv.Itoa(r.Line)
+	}
+	if r.Func != "" {
+		params["func"] = r.Func
+	}
+	if r.TraceLevel != notATrace {
+		params["trace_level"] = strconv.Itoa(r.TraceLevel)
+	}
+	if r.Version != "" {
+		params["version"] = r.Version
+	}
+	if r.Seq != 0 {
+		params["seq"] = strconv.FormatUint(r.Seq, 10)
+	}
+	if r.TimeSeq != 0 {
+		params["time_seq"] = strconv.FormatUint(r.TimeSeq, 10)
+	}
+	for k, v := range r.Fields {
+		params[rfc5424Name(k, rfc5424MaxSDName)] = fmt.Sprint(v)
+	}
+
+	// Structured data is a single '-' if there are no parameters. The
+	// parameters are sorted, so that the output is stable.
+	sd := "-"
+	if len(params) > 0 {
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		b.WriteString("[" + rfc5424Name(sdID, rfc5424MaxSDName))
+		for _, name := range names {
+			fmt.Fprintf(&b, ` %s="%s"`, name, rfc5424ParamEscaper.Replace(params[name]))
+		}
+		b.WriteString("]")
+		sd = b.String()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		facility*8+syslogSeverities[r.severity()],
+		r.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		rfc5424Name(host, rfc5424MaxHostname),
+		rfc5424Name(appName, rfc5424MaxAppName),
+		os.Getpid(),
+		rfc5424Name(f.MsgID, rfc5424MaxMsgID),
+		sd, r.Message)
+}
+
+// rfc5424Name makes a string usable as header field or name in an RFC5424
+// message. Those may only contain printable ASCII characters, without spaces.
+// For names in structured data '=', ']' and '"' aren't allowed either. Such
+// characters are replaced by '_'. An empty string becomes '-', the nil value
+// of RFC5424.
+func rfc5424Name(s string, maxLen int) string {
+	if s == "" {
+		return "-"
+	}
+	name := []byte(s)
+	for i, c := range name {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+	if len(name) > maxLen {
+		name = name[:maxLen]
+	}
+	return string(name)
+}
@@ -22,12 +22,16 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,6 +41,26 @@ const (
 	noTraceOutput = -1
 )
 
+// The highest trace level. Trace levels of messages range from 0 to this
+// value, and so do the levels of trace filters, except for noTraceOutput.
+const maxTraceLevel = 1000
+
+// Keywords, which can be used instead of the number in trace filters.
+var traceLevelKeywords = map[string]int{
+	"ALL":  maxTraceLevel,
+	"MAX":  maxTraceLevel,
+	"OFF":  noTraceOutput,
+	"NONE": noTraceOutput,
+}
+
+// Filter patterns with this prefix are matched against the function name,
+// rather than the filename.
+const funcFilterPrefix = "func:"
+
+// Filter patterns with this prefix are matched against the package of the
+// calling function, rather than the filename.
+const pkgFilterPrefix = "pkg:"
+
 // The known log levels
 const (
 	levelNone = iota
@@ -48,6 +72,24 @@ const (
 	levelTrace
 )
 
+// levelEnabled returns true if a message with the given level is logged, when
+// the given level is configured. Log levels are numbered from the most severe
+// (levelCrit) to the least severe (levelTrace), so a configured level enables
+// itself and all levels with a lower number: With levelWarn, the levels
+// levelCrit, levelErr and levelWarn are logged. Trace levels work the same
+// way: A configured trace level of 3 enables trace levels 0 to 3. A configured
+// level of levelNone (0) therefore only lets trace level 0 through, while
+// noTraceOutput (-1) disables everything.
+//
+// All comparisons of message and configured levels should use this function,
+// rather than comparing the numbers directly.
+func levelEnabled(messageLevel, configuredLevel int) bool {
+	return messageLevel <= configuredLevel
+}
+
+// sampleTime is an arbitrary, known time, which is used to check time layouts.
+var sampleTime = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
 // Translation map from level to string representation
 var levelStrings = map[int]string{
 	levelTrace: "TRACE",
@@ -70,6 +112,31 @@ var levelNumbers = map[string]int{
 	"NONE":     levelNone,
 }
 
+// Level is a log level, as used by LogLevel(). It avoids looking up the level
+// by name for every message.
+type Level int
+
+// The log levels, which can be used with LogLevel().
+const (
+	CriticalLevel Level = levelCrit
+	ErrorLevel    Level = levelErr
+	WarnLevel     Level = levelWarn
+	InfoLevel     Level = levelInfo
+	DebugLevel    Level = levelDebug
+)
+
+// String returns the name of the level, as shown in the log output.
+func (l Level) String() string {
+	if name, ok := levelStrings[int(l)]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Additional prefixes for the level decoration in the log output, as set via
+// SetLevelPrefix().
+var levelPrefixes = map[int]string{}
+
 // filterSpec holds a list of filters. These are applied to the 'caller'
 // information of a log message (calling module and file) to see if this
 // message should be logged. Different log or trace levels per file can
@@ -77,6 +144,11 @@ var levelNumbers = map[string]int{
 // messages this is going to be the trace level.
 type filterSpec struct {
 	filters []filter
+
+	// If all filters are for literal filenames (no global filter, no
+	// wildcards and no function names), this holds those filenames. Messages
+	// from any other file can then be rejected with a single lookup.
+	literalFiles map[string]bool
 }
 
 // filter holds filename and level to match logs against log messages.
@@ -85,6 +157,25 @@ type filter struct {
 	Level   int
 }
 
+// Filter is a single entry of a log or trace level spec, as returned by
+// ParseLogSpec(), ParseTraceSpec(), LogFilters() or TraceFilters(). An empty pattern denotes the global
+// level. For trace specs, the level is the trace level. For log specs, it is
+// the number of the log level, where a lower number means a more severe level.
+type Filter struct {
+	Pattern string // file or 'func:' pattern, empty for the global level
+	Level   int    // the log or trace level of this filter
+}
+
+// String returns the filter in the format of a spec entry, such as
+// "client.go=3". The level is always shown as a number, since a filter doesn't
+// know whether it belongs to a log or a trace spec.
+func (f Filter) String() string {
+	if f.Pattern == "" {
+		return strconv.Itoa(f.Level)
+	}
+	return f.Pattern + "=" + strconv.Itoa(f.Level)
+}
+
 // rlogConfig captures the entire configuration of rlog, as supplied by a user
 // via environment variables and/or config files. This still requires checking
 // and translation into more easily used config items. All values therefore are
@@ -95,11 +186,22 @@ type rlogConfig struct {
 	logTimeFormat   string // The time format spec for date/time stamps in output
 	logFile         string // Name of logfile
 	confFile        string // Name of config file
-	logStream       string // Name of logstream: stdout, stderr or NONE
+	logStream       string // Name of logstream: stdout, stderr, syslog or NONE
 	logNoTime       string // Flag to determine if date/time is logged at all
 	showCallerInfo  string // Flag to determine if caller info is logged
 	showGoroutineID string // Flag to determine if goroute ID shows in caller info
 	confCheckInterv string // Interval in seconds for checking config file
+	showHostname    string // Flag to determine if the host name is logged
+	hostname        string // Host name to use instead of the kernel's host name
+	defaultLogLevel string // Log level if none is specified in logLevel
+	skipPackages    string // Packages to skip when determining the caller
+	showSeq         string // Flag to determine if sequence numbers are logged
+	splitStreams    string // Flag to send less severe messages to stdout
+	levelNumeric    string // Show levels as numbers: true, false or "syslog"
+	fileBufferKB    string // Size of the buffer for the logfile, in KB
+	strict          string // Flag to warn if all log output is disabled
+	allowOverride   string // Flag to allow '!' in the config file to override
+	callerFields    string // Components of the caller info to log
 }
 
 // We keep a copy of what was supplied via environment variables, since we will
@@ -107,30 +209,159 @@ type rlogConfig struct {
 // determine which values take precedence.
 var configFromEnvVars rlogConfig
 
+// The settings, which were read via LoadConfig(). They are kept apart from the
+// environment variables and are merged in every time the config file is read,
+// just as if they were from a config file preceding all others. The map is
+// never modified, but replaced as a whole.
+var loadedSettings map[string]configSetting
+
 // The configuration items in rlogConfig are what is supplied by the user
 // (usually via environment variables). They are not the actual running
 // configuration.  We interpret this, combine it with configuration from the
 // config file and produce pre-processed configuration values, which are stored
 // in those variables below.
 var (
-	settingShowCallerInfo  bool   // whether we log caller info
-	settingShowGoroutineID bool   // whether we show goroutine ID in caller info
-	settingDateTimeFormat  string // flags for date/time output
-	settingConfFile        string // config file name
+	settingShowCallerInfo  bool     // whether we log caller info
+	settingShowGoroutineID bool     // whether we show goroutine ID in caller info
+	settingShowHostname    bool     // whether we log the host name
+	settingShowSeq         bool     // whether we log sequence numbers
+	settingHostname        string   // configured host name, overrides the kernel's
+	settingSkipPackages    []string // packages skipped when looking for the caller
+	settingDateTimeFormat  string   // flags for date/time output
+	settingConfFile        string   // config file name
 	// how often we check the conf file
 	settingCheckInterval time.Duration = 15 * time.Second
 
 	logWriterStream     *log.Logger // the first writer to which output is sent
 	logWriterFile       *log.Logger // the second writer to which output is sent
+	logWriterTrace      *log.Logger // the writer for trace messages, if separate
+	logWriterInfo       *log.Logger // stream for messages below WARN, if split
 	logFilterSpec       *filterSpec // filters for log messages
 	traceFilterSpec     *filterSpec // filters for trace messages
 	lastConfigFileCheck time.Time   // when did we last check the config file
 	currentLogFile      *os.File    // the logfile currently in use
 	currentLogFileName  string      // name of current log file
 
+	// Protects currentLogFile, which is also replaced when the logfile is
+	// reopened, possibly by the background flushing.
+	currentLogFileMutex sync.Mutex
+
+	// name of a config file, which we already reported as not usable
+	confFileIssueReported string
+
+	// whether to warn if all output is disabled, and whether we did so
+	settingStrict          bool
+	outputDisabledReported bool
+
+	// The application version set via SetVersion() and the prefix for text
+	// output, which is prepared in advance.
+	settingVersion       string
+	settingVersionPrefix string
+
+	// The maximum severity of messages, as set via SetMaxEmittedLevel(), and
+	// whether more severe messages are downgraded, rather than dropped. A level
+	// of levelNone means there is no maximum.
+	settingMaxLevel          int
+	settingMaxLevelDowngrade bool
+
+	// The least severe level of messages, which are considered at all, as
+	// set via SetGlobalMinLevel(). A level of levelNone means there is no
+	// minimum.
+	settingMinLevel int
+
+	// The numbers shown instead of the level names, as enabled via
+	// RLOG_LEVEL_NUMERIC. If nil, the names are shown.
+	settingLevelNumbers map[int]string
+
+	// A global trace level, which was set via EnableTrace() or DisableTrace()
+	// and which is applied on top of the configured trace filters.
+	traceLevelOverridden bool
+	traceLevelOverride   int
+
+	// A global log level, which was set via SIGUSR1 and which is applied on
+	// top of the configured log filters.
+	logLevelOverridden bool
+	logLevelOverride   int
+
+	// Whether all output was switched off via Discard(), regardless of the
+	// configured stream and logfile.
+	discardOverridden bool
+
+	// The trace level for files with a raised log level, as set via
+	// EnableTraceForLoggedFiles().
+	traceLoggedFilesEnabled bool
+	traceLoggedFilesLevel   int
+
+	// Formats the trace level, which is shown after "TRACE" in the text
+	// output, as set via SetTraceLevelFormat(). If nil, it's shown as "(3)".
+	settingTraceLevelFormat func(int) string
+
+	// Whether the trace level is left out of the text output entirely, as
+	// set via SetTraceShowLevel().
+	settingTraceHideLevel bool
+
 	initMutex sync.RWMutex = sync.RWMutex{} // used to protect the init section
 )
 
+// clock returns the current time. All of rlog's time stamps and time
+// calculations use it, so that tests can control the time via SetClock().
+var clock = time.Now
+
+// The sequence number of the last logged message, if sequence numbers are
+// enabled via RLOG_SHOW_SEQ. It's only ever incremented, so that sequence
+// numbers are unique within a process.
+var logSequence uint64
+
+// The time stamp of the last logged message and the number of messages with
+// that time stamp, if enabled via SetTimeSeq().
+var (
+	settingTimeSeq bool
+	timeSeqMutex   sync.Mutex
+	timeSeqStamp   string
+	timeSeqCount   uint64
+)
+
+// SetTimeSeq enables or disables numbering the messages, which have the same
+// formatted time stamp. In the text output, the number is shown in brackets
+// after the time stamp, starting at 1 for the first message of each time
+// stamp. This allows to order messages, which were logged within the same
+// instant, even if the sequence numbers of RLOG_SHOW_SEQ aren't used. If no
+// time stamp is shown, all messages count as having the same one.
+func SetTimeSeq(enabled bool) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingTimeSeq = enabled
+	timeSeqStamp = ""
+	timeSeqCount = 0
+}
+
+// nextTimeSeq returns the number of the next message with the given formatted
+// time stamp.
+func nextTimeSeq(timeStamp string) uint64 {
+	timeSeqMutex.Lock()
+	defer timeSeqMutex.Unlock()
+	if timeStamp != timeSeqStamp {
+		timeSeqStamp = timeStamp
+		timeSeqCount = 0
+	}
+	timeSeqCount++
+	return timeSeqCount
+}
+
+// The last error of the log output, as returned by LastError(). Log output may
+// fail while initMutex is only held for reading, so this has its own mutex.
+var (
+	lastError      error
+	lastErrorMutex sync.Mutex
+)
+
+// The host name reported by the kernel. It is only looked up when it is first
+// needed.
+var (
+	kernelHostname     string
+	kernelHostnameOnce sync.Once
+)
+
 // fromString initializes filterSpec from string.
 //
 // Use the isTraceLevel flag to indicate whether the levels are numeric (for
@@ -140,7 +371,8 @@ var (
 //     filter:
 //       <pattern=level> | <level>
 //     pattern:
-//       shell glob to match caller file name
+//       shell glob to match caller file name, or 'func:' followed by a
+//       shell glob to match the caller function name
 //     level:
 //       log or trace level of the logs to enable in matched files.
 //
@@ -155,7 +387,18 @@ var (
 //     - "RLOG_LOG_LEVEL=client.go=ERROR,INFO,ip*=WARN"
 //       ERROR and higher for client.go, WARN or higher for all files whose
 //       name starts with 'ip', INFO for everyone else.
+//
+// Malformed filters are skipped and reported as rlog issues.
 func (spec *filterSpec) fromString(s string, isTraceLevels bool, globalLevelDefault int) {
+	for _, err := range spec.parse(s, isTraceLevels, globalLevelDefault) {
+		rlogIssue("%s", err)
+	}
+}
+
+// parse does the actual work for fromString. Malformed filters are skipped and
+// an error is returned for each of them.
+func (spec *filterSpec) parse(s string, isTraceLevels bool, globalLevelDefault int) []error {
+	var errs []error
 	var globalLevel int = globalLevelDefault
 	var levelToken string
 	var matchToken string
@@ -182,17 +425,34 @@ func (spec *filterSpec) fromString(s string, isTraceLevels bool, globalLevelDefa
 			levelToken = tokens[1]
 		} else {
 			// Skip anything else that's malformed
-			rlogIssue("Malformed log filter expression: '%s'", f)
+			errs = append(errs, fmt.Errorf("malformed log filter expression: '%s'", f))
+			continue
+		}
+		if levelToken == "" {
+			// An entirely empty filter is quietly ignored, but a pattern
+			// without a level is an error.
+			if matchToken != "" {
+				errs = append(errs, fmt.Errorf("missing level in log filter expression: '%s'", f))
+			}
 			continue
 		}
 		if isTraceLevels {
-			// The level token should contain a numeric value
-			if filterLevel, err = strconv.Atoi(levelToken); err != nil {
-				if levelToken != "" {
-					rlogIssue("Trace level '%s' is not a number.", levelToken)
-				}
+			// The level token should contain a numeric value or a keyword
+			if level, ok := traceLevelKeywords[strings.ToUpper(levelToken)]; ok {
+				filterLevel = level
+			} else if filterLevel, err = strconv.Atoi(levelToken); err != nil {
+				errs = append(errs, fmt.Errorf("trace level '%s' is neither a number nor a keyword", levelToken))
+				continue
+			}
+			// Anything above the highest trace level means all trace
+			// messages, but negative levels other than -1 make no sense.
+			if filterLevel < noTraceOutput {
+				errs = append(errs, fmt.Errorf("trace level '%s' is out of range", levelToken))
 				continue
 			}
+			if filterLevel > maxTraceLevel {
+				filterLevel = maxTraceLevel
+			}
 		} else {
 			// The level token should contain the name of a log level
 			levelToken = strings.ToUpper(levelToken)
@@ -201,9 +461,7 @@ func (spec *filterSpec) fromString(s string, isTraceLevels bool, globalLevelDefa
 				// User not allowed to set trace log levels, so if that or
 				// not a known log level then this specification will be
 				// ignored.
-				if levelToken != "" {
-					rlogIssue("Illegal log level '%s'.", levelToken)
-				}
+				errs = append(errs, fmt.Errorf("illegal log level '%s'", levelToken))
 				continue
 			}
 
@@ -227,21 +485,188 @@ func (spec *filterSpec) fromString(s string, isTraceLevels bool, globalLevelDefa
 	if !isTraceLevels || globalLevel != noTraceOutput {
 		spec.filters = append(spec.filters, filter{"", globalLevel})
 	}
+	spec.indexLiteralFiles()
+
+	return errs
+}
+
+// indexLiteralFiles sets up the literalFiles lookup of the spec, if all of its
+// filters are for literal filenames. This is common for trace levels, where
+// often only one or two files are traced.
+func (spec *filterSpec) indexLiteralFiles() {
+	spec.literalFiles = nil
+	if len(spec.filters) == 0 {
+		return
+	}
+	literalFiles := make(map[string]bool)
+	for _, f := range spec.filters {
+		if f.Pattern == "" || strings.HasPrefix(f.Pattern, funcFilterPrefix) ||
+			strings.HasPrefix(f.Pattern, pkgFilterPrefix) ||
+			strings.ContainsAny(f.Pattern, `*?[\`) {
+			return
+		}
+		literalFiles[f.Pattern] = true
+	}
+	spec.literalFiles = literalFiles
+}
+
+// exportFilters returns a copy of the filters in the spec.
+func (spec *filterSpec) exportFilters() []Filter {
+	filters := make([]Filter, len(spec.filters))
+	for i, f := range spec.filters {
+		filters[i] = Filter{Pattern: f.Pattern, Level: f.Level}
+	}
+	return filters
+}
+
+// ParseLogSpec parses a log level spec, in the same format as RLOG_LOG_LEVEL,
+// and returns the resulting filters. The global level is always the last
+// filter. Unlike the processing of RLOG_LOG_LEVEL, where malformed filters are
+// skipped, an error is returned for malformed input. This allows a spec to be
+// validated before it's applied.
+func ParseLogSpec(s string) ([]Filter, error) {
+	spec := new(filterSpec)
+	if errs := spec.parse(s, false, levelInfo); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return spec.exportFilters(), nil
+}
+
+// ParseTraceSpec parses a trace level spec, in the same format as
+// RLOG_TRACE_LEVEL, and returns the resulting filters. If a global trace level
+// is set, it's the last filter. An error is returned for malformed input.
+func ParseTraceSpec(s string) ([]Filter, error) {
+	spec := new(filterSpec)
+	if errs := spec.parse(s, true, noTraceOutput); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return spec.exportFilters(), nil
+}
+
+// LogFilters returns the filters for log messages, which are currently in
+// effect. The global level is always the last filter. This is useful to find
+// out why messages from a file are or aren't logged.
+func LogFilters() []Filter {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	return logFilterSpec.exportFilters()
+}
+
+// TraceFilters returns the filters for trace messages, which are currently in
+// effect, including a global trace level set via EnableTrace(). If a global
+// trace level is set, it's the last filter. An empty list means that trace
+// messages are disabled.
+func TraceFilters() []Filter {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	return traceFilterSpec.exportFilters()
+}
+
+// withGlobalLevel returns a copy of the filter spec, which retains all named
+// filters, but has its global filter replaced by the given level. As in
+// fromString, a level of noTraceOutput means that no global filter is stored
+// at all, so that the filter chain of a trace spec may end up being empty.
+func (spec *filterSpec) withGlobalLevel(level int) *filterSpec {
+	newSpec := new(filterSpec)
+	for _, f := range spec.filters {
+		if f.Pattern != "" {
+			newSpec.filters = append(newSpec.filters, f)
+		}
+	}
+	if level != noTraceOutput {
+		newSpec.filters = append(newSpec.filters, filter{"", level})
+	}
+	newSpec.indexLiteralFiles()
+	return newSpec
+}
+
+// globalLevel returns the level of the global filter of the spec, if it has
+// one.
+func (spec *filterSpec) globalLevel() (int, bool) {
+	for _, f := range spec.filters {
+		if f.Pattern == "" {
+			return f.Level, true
+		}
+	}
+	return 0, false
+}
+
+// withTraceForLoggedFiles returns a copy of the trace filter spec, with an
+// additional trace filter of the given level for each named filter of the log
+// filter spec, which is more verbose than the global log level. The new
+// filters come after the existing named trace filters, so that those still
+// take precedence, but before the global trace level.
+func (spec *filterSpec) withTraceForLoggedFiles(logSpec *filterSpec, level int) *filterSpec {
+	globalLogLevel, _ := logSpec.globalLevel()
+	newSpec := new(filterSpec)
+	var global []filter
+	for _, f := range spec.filters {
+		if f.Pattern != "" {
+			newSpec.filters = append(newSpec.filters, f)
+		} else {
+			global = append(global, f)
+		}
+	}
+	for _, f := range logSpec.filters {
+		if f.Pattern != "" && !levelEnabled(f.Level, globalLogLevel) {
+			newSpec.filters = append(newSpec.filters, filter{f.Pattern, level})
+		}
+	}
+	newSpec.filters = append(newSpec.filters, global...)
+	newSpec.indexLiteralFiles()
+	return newSpec
+}
+
+// FilterFunc decides whether a message is logged, based on the file and the
+// function name of its caller and on its level. If matched is false, the
+// filters from RLOG_LOG_LEVEL or RLOG_TRACE_LEVEL decide instead. Otherwise,
+// allow determines whether the message is logged.
+type FilterFunc func(file, funcName string, level int) (matched, allow bool)
+
+// The filter functions set via SetFilterFunc() and SetTraceFilterFunc().
+var (
+	settingFilterFunc      FilterFunc
+	settingTraceFilterFunc FilterFunc
+)
+
+// SetFilterFunc sets a function, which is asked first whether a log message is
+// logged, before the filters from RLOG_LOG_LEVEL. This allows filtering
+// policies, which can't be expressed with file patterns. The level can be
+// compared with CriticalLevel, ErrorLevel and so on. The file is the module and
+// file name, as shown in the caller info. The function isn't called if the
+// caller can't be determined, and not for messages below the minimum level
+// set via SetGlobalMinLevel(). A nil function removes it again.
+func SetFilterFunc(fn FilterFunc) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingFilterFunc = fn
+}
 
-	return
+// SetTraceFilterFunc works like SetFilterFunc(), but for trace messages. The
+// function is called with the trace level and is asked before the filters
+// from RLOG_TRACE_LEVEL.
+func SetTraceFilterFunc(fn FilterFunc) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingTraceFilterFunc = fn
 }
 
-// matchfilters checks if given filename and trace level are accepted
-// by any of the filters
-func (spec *filterSpec) matchfilters(filename string, level int) bool {
+// matchfilters checks if given filename, function name and trace level are
+// accepted by any of the filters
+func (spec *filterSpec) matchfilters(filename string, funcName string, level int) bool {
 	// If there are no filters then we don't match anything.
 	if len(spec.filters) == 0 {
 		return false
 	}
 
+	// Quick exit for files that none of the filters are for.
+	if spec.literalFiles != nil && !spec.literalFiles[path.Base(filename)] {
+		return false
+	}
+
 	// If at least one filter matches.
 	for _, filter := range spec.filters {
-		if matched, loggit := filter.match(filename, level); matched {
+		if matched, loggit := filter.match(filename, funcName, level); matched {
 			return loggit
 		}
 	}
@@ -249,24 +674,79 @@ func (spec *filterSpec) matchfilters(filename string, level int) bool {
 	return false
 }
 
-// match checks if given filename and level are matched by
+// matchGlobalFilter checks if the given level is accepted by the global filter,
+// ignoring all named filters. This is used when no caller information is
+// available, since then there is no filename to match the named filters
+// against.
+func (spec *filterSpec) matchGlobalFilter(level int) bool {
+	for _, f := range spec.filters {
+		if f.Pattern == "" {
+			return levelEnabled(level, f.Level)
+		}
+	}
+	return false
+}
+
+// match checks if given filename (or function name) and level are matched by
 // this filter. Returns two bools: One to indicate whether a filename match was
 // made, and the second to indicate whether the message should be logged
 // (matched the level).
-func (f filter) match(filename string, level int) (bool, bool) {
+//
+// Patterns starting with 'func:' are matched against the name of the calling
+// function, without its package path, for example 'HandleLogin' or
+// '(*Server).HandleLogin'. Patterns starting with 'pkg:' are matched against
+// the package of the calling function: Against the full import path if the
+// pattern contains a '/', otherwise just against the last element of it. All
+// other patterns are matched against the filename.
+func (f filter) match(filename string, funcName string, level int) (bool, bool) {
 	var match bool
-	if f.Pattern != "" {
-		match, _ = filepath.Match(f.Pattern, filepath.Base(filename))
+	if strings.HasPrefix(f.Pattern, funcFilterPrefix) {
+		match, _ = filepath.Match(f.Pattern[len(funcFilterPrefix):], shortFuncName(funcName))
+	} else if strings.HasPrefix(f.Pattern, pkgFilterPrefix) {
+		pattern := f.Pattern[len(pkgFilterPrefix):]
+		pkg := packagePath(funcName)
+		if !strings.Contains(pattern, "/") {
+			pkg = path.Base(pkg)
+		}
+		match, _ = filepath.Match(pattern, pkg)
+	} else if f.Pattern != "" {
+		match, _ = filepath.Match(f.Pattern, path.Base(filename))
 	} else {
 		match = true
 	}
 	if match {
-		return true, level <= f.Level
+		return true, levelEnabled(level, f.Level)
 	}
 
 	return false, false
 }
 
+// shortFuncName strips the package path from a fully qualified function name,
+// as returned by runtime.FuncForPC. For example, 'github.com/foo/bar.Baz'
+// becomes 'Baz' and 'main.(*Server).Handle' becomes '(*Server).Handle'.
+func shortFuncName(funcName string) string {
+	if i := strings.LastIndex(funcName, "/"); i >= 0 {
+		funcName = funcName[i+1:]
+	}
+	if i := strings.Index(funcName, "."); i >= 0 {
+		funcName = funcName[i+1:]
+	}
+	return funcName
+}
+
+// packagePath returns the import path of the package of a fully qualified
+// function name, as returned by runtime.FuncForPC. For example,
+// 'github.com/foo/bar.(*Server).Handle' becomes 'github.com/foo/bar'. Dots in
+// the last element of the path are escaped in function names, so they are
+// restored here.
+func packagePath(funcName string) string {
+	start := strings.LastIndex(funcName, "/") + 1
+	if i := strings.Index(funcName[start:], "."); i >= 0 {
+		funcName = funcName[:start+i]
+	}
+	return strings.Replace(funcName, "%2e", ".", -1)
+}
+
 // updateIfNeeded returns a new value for an existing config item. The priority
 // flag indicates whether the new value should always override the old value.
 // Otherwise, the new value will not be used in case the old value is already
@@ -278,10 +758,21 @@ func updateIfNeeded(oldVal string, newVal string, priority bool) string {
 	return oldVal
 }
 
-// updateConfigFromFile reads a configuration from the specified config file.
+// updateFlagIfNeeded is the same as updateIfNeeded, but for flags. Flags are
+// 'true', 'false' or unset. An old value, which is neither 'true' nor 'false',
+// is treated as unset, so it is replaced by the new value. An explicit 'false'
+// is kept, unless the new value has priority.
+func updateFlagIfNeeded(oldVal string, newVal string, priority bool) string {
+	if priority || !isBoolString(oldVal) {
+		return newVal
+	}
+	return oldVal
+}
+
+// updateConfigFromFile reads a configuration from the specified config files.
 // It merges the supplied config with the new values.
 func updateConfigFromFile(config *rlogConfig) {
-	lastConfigFileCheck = time.Now()
+	lastConfigFileCheck = clock()
 
 	settingConfFile = config.confFile
 	// If no config file was specified we will default to a known location.
@@ -290,8 +781,52 @@ func updateConfigFromFile(config *rlogConfig) {
 		settingConfFile = fmt.Sprintf("/etc/rlog/%s.conf", execName)
 	}
 
+	// Several config files are read in order, so that settings in later
+	// files replace those in earlier ones. The settings from LoadConfig()
+	// come first. Only then, the settings are merged with the supplied config.
+	settings := make(map[string]configSetting, len(loadedSettings))
+	for key, s := range loadedSettings {
+		settings[key] = s
+	}
+	for _, name := range confFileNames(settingConfFile) {
+		readConfigFile(name, config, settings)
+	}
+	for _, source := range mergeSettings(config, settings) {
+		rlogIssue("Unknown or illegal setting name in config file %s. Ignored.", source)
+	}
+}
+
+// confFileNames splits a list of config files, as given in RLOG_CONF_FILE,
+// into the individual file names. The names may be separated by commas or the
+// path list separator of the OS (':' on Unix, ';' on Windows).
+func confFileNames(list string) []string {
+	var names []string
+	for _, l := range strings.Split(list, ",") {
+		for _, name := range filepath.SplitList(l) {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// readConfigFile reads the settings from a single config file into the map of
+// settings.
+func readConfigFile(name string, config *rlogConfig, settings map[string]configSetting) {
+	// A path that isn't a regular file, such as a directory, is reported once
+	// and otherwise ignored, rather than producing a warning for every line
+	// we may be able to read from it.
+	if info, err := os.Stat(name); err == nil && !info.Mode().IsRegular() {
+		if confFileIssueReported != name {
+			rlogIssue("Config file %s is not a regular file. Ignored.", name)
+			confFileIssueReported = name
+		}
+		return
+	}
+
 	// Scan over the config file, line by line
-	file, err := os.Open(settingConfFile)
+	file, err := os.Open(name)
 	if err != nil {
 		// Any error while attempting to open the logfile ignored. In many
 		// cases there won't even be a config file, so we should not produce
@@ -300,7 +835,48 @@ func updateConfigFromFile(config *rlogConfig) {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	if err := readSettings(file, config, name, settings); err != nil {
+		rlogIssue("Cannot read config file %s: %s", name, err)
+	}
+}
+
+// configSetting is a single setting, as read from a config file.
+type configSetting struct {
+	val      string
+	priority bool   // whether the setting overrides the environment variables
+	source   string // file name and line number, for warnings
+}
+
+// parseConfig reads settings in the format of the config file from a reader
+// and merges them into the supplied config. The name of the source is used
+// in warnings about individual lines. The settings are returned as well, so
+// that they can be merged again later on. An error is returned if reading
+// fails or if a setting is unknown.
+func parseConfig(r io.Reader, config *rlogConfig, name string) (map[string]configSetting, error) {
+	settings := make(map[string]configSetting)
+	if err := readSettings(r, config, name, settings); err != nil {
+		return nil, err
+	}
+	if unknown := mergeSettings(config, settings); len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown or illegal setting name in %s", strings.Join(unknown, ", "))
+	}
+	return settings, nil
+}
+
+// readSettings reads settings in the format of the config file from a reader
+// into the map of settings, keyed by setting name. A setting, which is already
+// in the map from an earlier file, is replaced. Within the file, the rules of
+// updateIfNeeded apply: The first occurrence of a setting is used, unless a
+// later one has priority, because it's prefixed with '!'.
+func readSettings(r io.Reader, config *rlogConfig, name string, settings map[string]configSetting) error {
+	fileSettings := make(map[string]configSetting)
+	defer func() {
+		for key, s := range fileSettings {
+			settings[key] = s
+		}
+	}()
+	scanner := bufio.NewScanner(r)
 	i := 0
 	for scanner.Scan() {
 		i++
@@ -314,43 +890,114 @@ func updateConfigFromFile(config *rlogConfig) {
 		}
 		if len(tokens) != 2 {
 			rlogIssue("Malformed line in config file %s:%d. Ignored.",
-				settingConfFile, i)
+				name, i)
 			continue
 		}
-		name := strings.TrimSpace(tokens[0])
+		key := strings.TrimSpace(tokens[0])
 		val := strings.TrimSpace(tokens[1])
 
 		// If the name starts with a '!' then it should overwrite whatever we
-		// currently have in the config already.
+		// currently have in the config already, unless this was forbidden via
+		// RLOG_CONFIG_ALLOW_OVERRIDE.
 		priority := false
-		if name[0] == '!' {
-			priority = true
-			name = name[1:]
+		if key[0] == '!' {
+			key = key[1:]
+			if isFalseBoolString(config.allowOverride) {
+				rlogIssue("Override with '!' not allowed in config file %s:%d. Applied without priority.",
+					name, i)
+			} else {
+				priority = true
+			}
+		}
+		if old, ok := fileSettings[key]; ok && !priority && (old.priority || old.val != "") {
+			continue
+		}
+		fileSettings[key] = configSetting{
+			val:      val,
+			priority: priority,
+			source:   fmt.Sprintf("%s:%d", name, i),
 		}
+	}
+	return scanner.Err()
+}
 
-		switch name {
+// mergeSettings merges settings, which were read from config files, into the
+// supplied config. The sources of settings with an unknown name are returned.
+func mergeSettings(config *rlogConfig, settings map[string]configSetting) (unknown []string) {
+	for key, s := range settings {
+		switch key {
 		case "RLOG_LOG_LEVEL":
-			config.logLevel = updateIfNeeded(config.logLevel, val, priority)
+			config.logLevel = updateIfNeeded(config.logLevel, s.val, s.priority)
 		case "RLOG_TRACE_LEVEL":
-			config.traceLevel = updateIfNeeded(config.traceLevel, val, priority)
+			config.traceLevel = updateIfNeeded(config.traceLevel, s.val, s.priority)
 		case "RLOG_TIME_FORMAT":
-			config.logTimeFormat = updateIfNeeded(config.logTimeFormat, val, priority)
+			config.logTimeFormat = updateIfNeeded(config.logTimeFormat, s.val, s.priority)
 		case "RLOG_LOG_FILE":
-			config.logFile = updateIfNeeded(config.logFile, val, priority)
+			config.logFile = updateIfNeeded(config.logFile, s.val, s.priority)
 		case "RLOG_LOG_STREAM":
-			val = strings.ToUpper(val)
-			config.logStream = updateIfNeeded(config.logStream, val, priority)
+			config.logStream = updateIfNeeded(config.logStream, strings.ToUpper(s.val), s.priority)
 		case "RLOG_LOG_NOTIME":
-			config.logNoTime = updateIfNeeded(config.logNoTime, val, priority)
+			config.logNoTime = updateFlagIfNeeded(config.logNoTime, s.val, s.priority)
 		case "RLOG_CALLER_INFO":
-			config.showCallerInfo = updateIfNeeded(config.showCallerInfo, val, priority)
+			config.showCallerInfo = updateFlagIfNeeded(config.showCallerInfo, s.val, s.priority)
+		case "RLOG_CALLER_FIELDS":
+			config.callerFields = updateIfNeeded(config.callerFields, s.val, s.priority)
 		case "RLOG_GOROUTINE_ID":
-			config.showGoroutineID = updateIfNeeded(config.showGoroutineID, val, priority)
+			config.showGoroutineID = updateFlagIfNeeded(config.showGoroutineID, s.val, s.priority)
+		case "RLOG_SHOW_HOSTNAME":
+			config.showHostname = updateFlagIfNeeded(config.showHostname, s.val, s.priority)
+		case "RLOG_SHOW_SEQ":
+			config.showSeq = updateFlagIfNeeded(config.showSeq, s.val, s.priority)
+		case "RLOG_SPLIT_STREAMS":
+			config.splitStreams = updateFlagIfNeeded(config.splitStreams, s.val, s.priority)
+		case "RLOG_LEVEL_NUMERIC":
+			config.levelNumeric = updateIfNeeded(config.levelNumeric, s.val, s.priority)
+		case "RLOG_LOG_FILE_BUFFER_KB":
+			config.fileBufferKB = updateIfNeeded(config.fileBufferKB, s.val, s.priority)
+		case "RLOG_STRICT":
+			config.strict = updateFlagIfNeeded(config.strict, s.val, s.priority)
+		case "RLOG_HOSTNAME":
+			config.hostname = updateIfNeeded(config.hostname, s.val, s.priority)
+		case "RLOG_DEFAULT_LOG_LEVEL":
+			config.defaultLogLevel = updateIfNeeded(config.defaultLogLevel, s.val, s.priority)
+		case "RLOG_SKIP_PACKAGES":
+			config.skipPackages = updateIfNeeded(config.skipPackages, s.val, s.priority)
 		default:
-			rlogIssue("Unknown or illegal setting name in config file %s:%d. Ignored.",
-				settingConfFile, i)
+			unknown = append(unknown, s.source)
+		}
+	}
+	return unknown
+}
+
+// LoadConfig reads settings in the format of the config file from a reader,
+// for example from an embedded asset or a string held by the program. These
+// settings are merged with the ones from the environment variables in the
+// same way as those of a config file, which is read before the files given
+// in RLOG_CONF_FILE. So a setting in one of these files replaces a setting of
+// the same name. The settings are kept when the configuration is changed
+// later on, until LoadConfig() is called again or Reconfigure() is used.
+// Nothing is changed if reading fails or if any of the settings is invalid.
+// Files, such as the logfile, aren't opened for this check.
+func LoadConfig(r io.Reader) error {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+
+	config := configFromEnvVars
+	settings, err := parseConfig(r, &config, "<LoadConfig>")
+	if err != nil {
+		return fmt.Errorf("cannot read configuration: %s", err)
+	}
+	if errs := config.checkValues(); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
 		}
+		return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
 	}
+	loadedSettings = settings
+	applyConfig(configFromEnvVars)
+	checkOutputEnabled()
+	return nil
 }
 
 // init extracts settings for our logger from environment variables when the
@@ -369,10 +1016,59 @@ func init() {
 		showCallerInfo:  os.Getenv("RLOG_CALLER_INFO"),
 		showGoroutineID: os.Getenv("RLOG_GOROUTINE_ID"),
 		confCheckInterv: os.Getenv("RLOG_CONF_CHECK_INTERVAL"),
+		allowOverride:   os.Getenv("RLOG_CONFIG_ALLOW_OVERRIDE"),
+		callerFields:    os.Getenv("RLOG_CALLER_FIELDS"),
+		showHostname:    os.Getenv("RLOG_SHOW_HOSTNAME"),
+		hostname:        os.Getenv("RLOG_HOSTNAME"),
+		defaultLogLevel: os.Getenv("RLOG_DEFAULT_LOG_LEVEL"),
+		skipPackages:    os.Getenv("RLOG_SKIP_PACKAGES"),
+		showSeq:         os.Getenv("RLOG_SHOW_SEQ"),
+		splitStreams:    os.Getenv("RLOG_SPLIT_STREAMS"),
+		levelNumeric:    os.Getenv("RLOG_LEVEL_NUMERIC"),
+		fileBufferKB:    os.Getenv("RLOG_LOG_FILE_BUFFER_KB"),
+		strict:          os.Getenv("RLOG_STRICT"),
 	}
 	// Pass the environment variable config through to the next stage, which
 	// produces an updated config based on config file values.
 	initialize(config, true)
+
+	if isTrueBoolString(os.Getenv("RLOG_SIGUSR1_CYCLE")) {
+		startLevelCycle()
+	}
+	if isTrueBoolString(os.Getenv("RLOG_SIGHUP_REOPEN")) {
+		installReopenHandler()
+	}
+}
+
+// timeOnlyFormat is the layout of the TIMEONLY preset: Just the time of day, with
+// milliseconds, for short running tools where the date is only noise.
+const timeOnlyFormat = "15:04:05.000"
+
+// The well known time formats, which may be used by name in RLOG_TIME_FORMAT.
+var namedTimeFormats = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UNIXDATE":    time.UnixDate,
+	"RUBYDATE":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339NANO": time.RFC3339Nano,
+	"KITCHEN":     time.Kitchen,
+	"TIMEONLY":    timeOnlyFormat,
+}
+
+// checkTimeFormat returns an error if the given time format is neither the
+// name of a well known format, nor a layout with any date or time elements.
+func checkTimeFormat(layout string) error {
+	if _, ok := namedTimeFormats[strings.ToUpper(layout)]; ok {
+		return nil
+	}
+	if sampleTime.Format(layout) == layout {
+		return fmt.Errorf("time format '%s' contains no date or time elements", layout)
+	}
+	return nil
 }
 
 // getTimeFormat returns the time format we should use for time stamps in log
@@ -384,29 +1080,8 @@ func getTimeFormat(config rlogConfig) string {
 		// Store the format string for date/time logging. Allowed values are
 		// all the constants specified in
 		// https://golang.org/src/time/format.go.
-		var f string
-		switch strings.ToUpper(config.logTimeFormat) {
-		case "ANSIC":
-			f = time.ANSIC
-		case "UNIXDATE":
-			f = time.UnixDate
-		case "RUBYDATE":
-			f = time.RubyDate
-		case "RFC822":
-			f = time.RFC822
-		case "RFC822Z":
-			f = time.RFC822Z
-		case "RFC1123":
-			f = time.RFC1123
-		case "RFC1123Z":
-			f = time.RFC1123Z
-		case "RFC3339":
-			f = time.RFC3339
-		case "RFC3339NANO":
-			f = time.RFC3339Nano
-		case "KITCHEN":
-			f = time.Kitchen
-		default:
+		f, ok := namedTimeFormats[strings.ToUpper(config.logTimeFormat)]
+		if !ok {
 			if config.logTimeFormat != "" {
 				f = config.logTimeFormat
 			} else {
@@ -427,14 +1102,49 @@ func getTimeFormat(config rlogConfig) string {
 // If the reInitEnvVars flag is set then the passed-in configuration overwrites
 // the settings stored from the environment variables, which we need for our tests.
 func initialize(config rlogConfig, reInitEnvVars bool) {
-	var err error
-
 	initMutex.Lock()
 	defer initMutex.Unlock()
 
 	if reInitEnvVars {
 		configFromEnvVars = config
+		loadedSettings = nil
+		traceLevelOverridden = false
+		logLevelOverridden = false
+		discardOverridden = false
+		traceLoggedFilesEnabled = false
+	}
+	applyConfig(config)
+	checkOutputEnabled()
+}
+
+// updateConfig changes the settings, which were taken from the environment
+// variables, and applies the result. All of this happens while holding the
+// write lock of initMutex, so that concurrent log calls and config reloads
+// never see a partial update.
+func updateConfig(change func(config *rlogConfig)) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	change(&configFromEnvVars)
+	applyConfig(configFromEnvVars)
+	checkOutputEnabled()
+}
+
+// reloadConfig reads the config file again, when the check interval has
+// expired. Several goroutines may notice this at the same time, but only the
+// first one to get the write lock of initMutex does the work.
+func reloadConfig() {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	if settingCheckInterval > 0 && clock().Sub(lastConfigFileCheck) > settingCheckInterval {
+		applyConfig(configFromEnvVars)
+		checkOutputEnabled()
 	}
+}
+
+// applyConfig does the actual work for initialize(). The caller needs to hold
+// the write lock of initMutex.
+func applyConfig(config rlogConfig) {
+	var err error
 
 	// Read and merge configuration from the config file
 	updateConfigFromFile(&config)
@@ -450,17 +1160,61 @@ func initialize(config rlogConfig, reInitEnvVars bool) {
 		}
 	}
 	settingShowCallerInfo = isTrueBoolString(config.showCallerInfo)
+	settingCallerFields, err = parseCallerFields(config.callerFields)
+	if err != nil {
+		rlogIssue("%s. Using all caller fields.", err)
+	}
 	settingShowGoroutineID = isTrueBoolString(config.showGoroutineID)
+	settingShowHostname = isTrueBoolString(config.showHostname)
+	settingShowSeq = isTrueBoolString(config.showSeq)
+	settingStrict = isTrueBoolString(config.strict)
+	settingLevelNumbers = nil
+	if strings.EqualFold(config.levelNumeric, "syslog") {
+		settingLevelNumbers = make(map[int]string)
+		for level, name := range levelStrings {
+			settingLevelNumbers[level] = strconv.Itoa(syslogSeverities[name])
+		}
+	} else if isTrueBoolString(config.levelNumeric) {
+		settingLevelNumbers = make(map[int]string)
+		for level := range levelStrings {
+			settingLevelNumbers[level] = strconv.Itoa(level)
+		}
+	}
+	settingHostname = config.hostname
+	settingSkipPackages = nil
+	for _, p := range strings.Split(config.skipPackages, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			settingSkipPackages = append(settingSkipPackages, p)
+		}
+	}
 
 	// initialize filters for trace (by default no trace output) and log levels
 	// (by default INFO level).
 	newTraceFilterSpec := new(filterSpec)
 	newTraceFilterSpec.fromString(config.traceLevel, true, noTraceOutput)
+	if traceLevelOverridden {
+		newTraceFilterSpec = newTraceFilterSpec.withGlobalLevel(traceLevelOverride)
+	}
 	traceFilterSpec = newTraceFilterSpec
 
+	defaultLogLevel := levelInfo
+	if config.defaultLogLevel != "" {
+		level, ok := levelNumbers[strings.ToUpper(config.defaultLogLevel)]
+		if ok && level != levelTrace {
+			defaultLogLevel = level
+		} else {
+			rlogIssue("Illegal default log level '%s'. Using INFO.", config.defaultLogLevel)
+		}
+	}
 	newLogFilterSpec := new(filterSpec)
-	newLogFilterSpec.fromString(config.logLevel, false, levelInfo)
+	newLogFilterSpec.fromString(config.logLevel, false, defaultLogLevel)
+	if logLevelOverridden {
+		newLogFilterSpec = newLogFilterSpec.withGlobalLevel(logLevelOverride)
+	}
 	logFilterSpec = newLogFilterSpec
+	if traceLoggedFilesEnabled {
+		traceFilterSpec = traceFilterSpec.withTraceForLoggedFiles(logFilterSpec, traceLoggedFilesLevel)
+	}
 
 	// Evaluate the specified date/time format
 	settingDateTimeFormat = getTimeFormat(config)
@@ -470,81 +1224,1373 @@ func initialize(config rlogConfig, reInitEnvVars bool) {
 	// By default (if flag is not set) we want to log date and time.
 	// Note that in our log writers we disable date/time loggin, since we will
 	// take care of producing this ourselves.
-	if config.logStream == "STDOUT" {
-		logWriterStream = log.New(os.Stdout, "", 0)
-	} else if config.logStream == "NONE" {
+	if discardOverridden {
+		// Output stays switched off until SetOutput() is called.
+		config.logStream = "NONE"
+		config.logFile = ""
+	}
+	logWriterInfo = nil
+	switch {
+	case config.logStream == "NONE" || config.logStream == "DISCARD":
 		logWriterStream = nil
-	} else {
+	case config.logStream == "SYSLOG":
+		if syslogWriter == nil {
+			syslogWriter, err = openSyslog("")
+		}
+		if err == nil {
+			logWriterStream = log.New(syslogWriter, "", 0)
+		} else {
+			rlogIssue("Unable to connect to syslog: %s. Using stderr.", err)
+			logWriterStream = log.New(os.Stderr, "", 0)
+		}
+	case isTrueBoolString(config.splitStreams):
+		// Split streams: Warnings and errors go to stderr, everything else
+		// to stdout.
+		logWriterStream = log.New(os.Stderr, "", 0)
+		logWriterInfo = log.New(os.Stdout, "", 0)
+	case config.logStream == "STDOUT":
+		logWriterStream = log.New(os.Stdout, "", 0)
+	default:
+		if config.logStream != "" && config.logStream != "STDERR" {
+			rlogIssue("Unknown log stream '%s'. Using stderr.", config.logStream)
+		}
 		logWriterStream = log.New(os.Stderr, "", 0)
 	}
 
 	// ... but if requested we'll also create and/or append to a logfile
-	var newLogFile *os.File
-	if currentLogFileName != config.logFile { // something changed
-		if config.logFile == "" {
-			// no more log output to a file
-			logWriterFile = nil
+	bufferSize := 0
+	if config.fileBufferKB != "" {
+		kb, err := strconv.Atoi(config.fileBufferKB)
+		if err == nil && kb >= 0 {
+			bufferSize = kb * 1024
 		} else {
-			// Check if the logfile was changed or was set for the first
-			// time. Only then do we need to open/create a new file.
-			// We also do this if for some reason we don't have a log writer
-			// yet.
-			if currentLogFileName != config.logFile || logWriterFile == nil {
-				newLogFile, err = os.OpenFile(config.logFile,
-					os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-				if err == nil {
-					logWriterFile = log.New(newLogFile, "", 0)
-				} else {
-					rlogIssue("Unable to open log file: %s", err)
-					return
-				}
-			}
+			rlogIssue("Illegal log file buffer size '%s'. Not buffering.", config.fileBufferKB)
+		}
+	}
+	w := currentLogFileWriter()
+	if config.logFile == "" {
+		// no more log output to a file
+		if logWriterFile != nil || currentLogFileName != "" {
+			closeLogFileWriter()
+			logWriterFile = nil
+			closeCurrentLogFile()
 		}
+	} else if currentLogFileName != config.logFile || w == nil || !w.isCurrentFile() {
+		// The logfile was changed or was set for the first time. Then we
+		// need to open/create a new file. We also do this if we don't have a
+		// log writer yet, or if the file was removed or replaced, for
+		// example by logrotate.
+		newLogFile, err := openLogFile(config.logFile)
+		if err != nil {
+			rlogIssue("Unable to open log file: %s", err)
+			setLastError(err)
+			return
+		}
+		writeFileHeader(newLogFile)
+		closeLogFileWriter()
+		logWriterFile = log.New(newLogFileWriter(config.logFile,
+			newLogFile, bufferSize), "", 0)
 
 		// Close the old logfile, since we are now writing to a new file
-		if currentLogFileName != "" {
+		currentLogFileMutex.Lock()
+		if currentLogFile != nil {
 			currentLogFile.Close()
-			currentLogFileName = config.logFile
-			currentLogFile = newLogFile
 		}
+		currentLogFileName = config.logFile
+		currentLogFile = newLogFile
+		currentLogFileMutex.Unlock()
+	} else if w.bufferSize() != bufferSize {
+		// Only the size of the buffer changed, so the file stays open and
+		// just gets a new writer.
+		closeLogFileWriter()
+		logWriterFile = log.New(newLogFileWriter(w.name, w.file, bufferSize), "", 0)
 	}
 }
 
-// SetConfFile enables the programmatic setting of a new config file path.
-// Any config values specified in that file will be immediately applied.
-func SetConfFile(confFileName string) {
-	configFromEnvVars.confFile = confFileName
-	initialize(configFromEnvVars, false)
+// checkOutputEnabled warns about a configuration, which disables all log
+// output, if RLOG_STRICT is set. This is most likely a mistake. The warning is
+// only given once, not every time the config file is read again. Output,
+// which was switched off via Discard(), is intended and not warned about. The
+// caller needs to hold the write lock of initMutex.
+func checkOutputEnabled() {
+	if !settingStrict || !isDiscarding() || discardOverridden {
+		outputDisabledReported = false
+		return
+	}
+	if !outputDisabledReported {
+		rlogIssue("All log output is disabled. Check RLOG_LOG_STREAM and RLOG_LOG_FILE.")
+		outputDisabledReported = true
+	}
 }
 
-// SetOutput re-wires the log output to a new io.Writer. By default rlog
-// logs to os.Stderr, but this function can be used to direct the output
-// somewhere else. If output to two destinations was specified via environment
-// variables then this will change it back to just one output.
-func SetOutput(writer io.Writer) {
-	// Use the stored date/time flag settings
-	logWriterStream = log.New(writer, "", 0)
-	logWriterFile = nil
-	if currentLogFile != nil {
-		currentLogFile.Close()
-		currentLogFileName = ""
-	}
+// Config is a complete configuration of rlog, which can be applied at runtime
+// with Reconfigure(). Each field takes the same values as the environment
+// variable of the same name, for example LogLevel corresponds to
+// RLOG_LOG_LEVEL and CallerInfo to RLOG_CALLER_INFO. Empty fields have the same
+// effect as unset environment variables. As with environment variables, values
+// from the config file are merged in.
+type Config struct {
+	LogLevel          string
+	TraceLevel        string
+	TimeFormat        string
+	LogFile           string
+	ConfFile          string
+	LogStream         string
+	LogNoTime         string
+	CallerInfo        string
+	GoroutineID       string
+	ConfCheckInterval string
+	ShowHostname      string
+	Hostname          string
+	DefaultLogLevel   string
+	SkipPackages      string
+	ShowSeq           string
+	SplitStreams      string
+	LevelNumeric      string
+	LogFileBufferKB   string
+	Strict            string
+	AllowOverride     string
+	CallerFields      string
+
+	Formatter Formatter // the formatter for log output, nil for text output
 }
 
-// isTrueBoolString tests a string to see if it represents a 'true' value.
-// The ParseBool function unfortunately doesn't recognize 'y' or 'yes', which
-// is why we added that test here as well.
-func isTrueBoolString(str string) bool {
-	str = strings.ToUpper(str)
-	if str == "Y" || str == "YES" {
-		return true
+// Reconfigure applies an entire new configuration at once. Unlike a series of
+// individual changes, log messages never see a partially applied
+// configuration. The configuration is checked first. If anything is rejected,
+// an error describing all problems is returned and the previous configuration
+// stays in effect. A trace level set via EnableTrace() and the settings read
+// via LoadConfig() are reset, while other runtime settings, for example the
+// version set via SetVersion(), are kept.
+func Reconfigure(config Config) error {
+	conf := rlogConfig{
+		logLevel:        config.LogLevel,
+		traceLevel:      config.TraceLevel,
+		logTimeFormat:   config.TimeFormat,
+		logFile:         config.LogFile,
+		confFile:        config.ConfFile,
+		logStream:       strings.ToUpper(config.LogStream),
+		logNoTime:       config.LogNoTime,
+		showCallerInfo:  config.CallerInfo,
+		showGoroutineID: config.GoroutineID,
+		confCheckInterv: config.ConfCheckInterval,
+		allowOverride:   config.AllowOverride,
+		callerFields:    config.CallerFields,
+		showHostname:    config.ShowHostname,
+		hostname:        config.Hostname,
+		defaultLogLevel: config.DefaultLogLevel,
+		skipPackages:    config.SkipPackages,
+		showSeq:         config.ShowSeq,
+		splitStreams:    config.SplitStreams,
+		levelNumeric:    config.LevelNumeric,
+		fileBufferKB:    config.LogFileBufferKB,
+		strict:          config.Strict,
 	}
-	if isTrue, err := strconv.ParseBool(str); err == nil && isTrue {
-		return true
+	if errs := conf.check(); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
+	}
+
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	configFromEnvVars = conf
+	loadedSettings = nil
+	traceLevelOverridden = false
+	logLevelOverridden = false
+	discardOverridden = false
+	traceLoggedFilesEnabled = false
+	settingFormatter = config.Formatter
+	applyConfig(conf)
+	checkOutputEnabled()
+	return nil
+}
+
+// check returns an error for each value of the config, which isn't valid,
+// including a logfile, which can't be opened.
+func (config rlogConfig) check() []error {
+	errs := config.checkValues()
+	if config.logFile != "" {
+		// The logfile is opened again when the config is applied, this only
+		// checks that this is possible.
+		if f, err := openLogFile(config.logFile); err != nil {
+			errs = append(errs, err)
+		} else {
+			f.Close()
+		}
+	}
+	return errs
+}
+
+// checkValues works like check(), but it doesn't open any files.
+func (config rlogConfig) checkValues() []error {
+	var errs []error
+	defaultLogLevel := levelInfo
+	if config.defaultLogLevel != "" {
+		level, ok := levelNumbers[strings.ToUpper(config.defaultLogLevel)]
+		if !ok || level == levelTrace {
+			errs = append(errs, fmt.Errorf("illegal default log level '%s'", config.defaultLogLevel))
+		} else {
+			defaultLogLevel = level
+		}
+	}
+	errs = append(errs, new(filterSpec).parse(config.logLevel, false, defaultLogLevel)...)
+	errs = append(errs, new(filterSpec).parse(config.traceLevel, true, noTraceOutput)...)
+	if config.logTimeFormat != "" {
+		if err := checkTimeFormat(config.logTimeFormat); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch config.logStream {
+	case "", "STDERR", "STDOUT", "SYSLOG", "NONE", "DISCARD":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log stream '%s'", config.logStream))
+	}
+	flags := []struct{ name, val string }{
+		{"log no time", config.logNoTime},
+		{"caller info", config.showCallerInfo},
+		{"goroutine ID", config.showGoroutineID},
+		{"show hostname", config.showHostname},
+		{"show sequence", config.showSeq},
+		{"split streams", config.splitStreams},
+		{"strict", config.strict},
+		{"allow override", config.allowOverride},
+	}
+	for _, flag := range flags {
+		if flag.val != "" && !isBoolString(flag.val) {
+			errs = append(errs, fmt.Errorf("%s flag '%s' is not a boolean", flag.name, flag.val))
+		}
+	}
+	if config.levelNumeric != "" && !isBoolString(config.levelNumeric) &&
+		!strings.EqualFold(config.levelNumeric, "syslog") {
+		errs = append(errs, fmt.Errorf("numeric level option '%s' is neither a boolean nor 'syslog'", config.levelNumeric))
+	}
+	if _, err := parseCallerFields(config.callerFields); err != nil {
+		errs = append(errs, err)
+	}
+	if config.confCheckInterv != "" {
+		if _, err := strconv.Atoi(config.confCheckInterv); err != nil {
+			errs = append(errs, fmt.Errorf("config check interval '%s' is not a number", config.confCheckInterv))
+		}
+	}
+	if config.fileBufferKB != "" {
+		if kb, err := strconv.Atoi(config.fileBufferKB); err != nil || kb < 0 {
+			errs = append(errs, fmt.Errorf("log file buffer size '%s' is not a valid number", config.fileBufferKB))
+		}
+	}
+	return errs
+}
+
+// SetConfFile enables the programmatic setting of a new config file path, or a
+// list of them, as in RLOG_CONF_FILE. Any config values specified in these
+// files will be immediately applied.
+func SetConfFile(confFileName string) {
+	updateConfig(func(config *rlogConfig) {
+		config.confFile = confFileName
+	})
+}
+
+// SetDefaultLogLevel changes the global log level, which is used if
+// RLOG_LOG_LEVEL doesn't specify one. This is INFO, unless it was changed via
+// RLOG_DEFAULT_LOG_LEVEL. For example, libraries may use this to get a quieter
+// default, while still honoring whatever the user has configured explicitly.
+func SetDefaultLogLevel(level string) error {
+	logLevel, ok := levelNumbers[strings.ToUpper(level)]
+	if !ok || logLevel == levelTrace {
+		return fmt.Errorf("illegal log level '%s'", level)
+	}
+	updateConfig(func(config *rlogConfig) {
+		config.defaultLogLevel = level
+	})
+	return nil
+}
+
+// SetShowTime enables or disables the date/time stamp in the log output at
+// runtime. This is useful if the output is redirected to a system that adds its
+// own time stamps. When the time stamp is enabled again, the configured time
+// format is used.
+func SetShowTime(showTime bool) {
+	updateConfig(func(config *rlogConfig) {
+		config.logNoTime = strconv.FormatBool(!showTime)
+	})
+}
+
+// SetTimeFormat changes the date/time format at runtime. The layout is a Go
+// time layout as described in https://golang.org/pkg/time/#Time.Format, or one
+// of the well known format names accepted by RLOG_TIME_FORMAT. An error is
+// returned if the layout doesn't contain any date or time elements. An empty
+// layout disables the time stamp, same as SetShowTime(false).
+func SetTimeFormat(layout string) error {
+	if layout == "" {
+		SetShowTime(false)
+		return nil
+	}
+	if err := checkTimeFormat(layout); err != nil {
+		return err
+	}
+	updateConfig(func(config *rlogConfig) {
+		config.logTimeFormat = layout
+		config.logNoTime = "false"
+	})
+	return nil
+}
+
+// SetVersion sets a version string for your application, which is then
+// included in every log message. This allows log messages to be correlated with
+// releases. In text output, the version is shown in square brackets before the
+// log level. An empty version removes it again.
+func SetVersion(version string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingVersion = version
+	settingVersionPrefix = ""
+	if version != "" {
+		settingVersionPrefix = "[" + version + "] "
+	}
+}
+
+// SetLevelPrefix sets a prefix, which is shown in front of the name of the
+// given level ("TRACE", "DEBUG", "INFO", "WARN", "ERROR" or "CRITICAL") in each
+// log line. For example, a symbol for quick visual scanning or a routing tag.
+// A space is inserted between the prefix and the level name. An empty prefix
+// removes it again.
+func SetLevelPrefix(level string, prefix string) error {
+	logLevel, ok := levelNumbers[strings.ToUpper(level)]
+	if !ok || logLevel == levelNone {
+		return fmt.Errorf("illegal log level '%s'", level)
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	if prefix == "" {
+		delete(levelPrefixes, logLevel)
+	} else {
+		levelPrefixes[logLevel] = prefix + " "
+	}
+	return nil
+}
+
+// SetTraceLevelFormat sets a function, which formats the trace level of trace
+// messages in the text output. The result is shown directly after "TRACE". By
+// default, the trace level is shown in brackets, as in "TRACE(3)". For example,
+// to show "TRACE.3" instead:
+//
+//	rlog.SetTraceLevelFormat(func(l int) string { return fmt.Sprintf(".%d", l) })
+//
+// A nil function restores the default. Formatters receive the trace level as a
+// separate field of the record, so they're not affected by this.
+func SetTraceLevelFormat(fn func(int) string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingTraceLevelFormat = fn
+}
+
+// SetTraceShowLevel determines whether the trace level is shown after "TRACE"
+// in the text output. If not, trace messages look like those of any other
+// level, while their trace level is still used for filtering. By default, the
+// trace level is shown.
+func SetTraceShowLevel(show bool) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingTraceHideLevel = !show
+}
+
+// traceLevelPrefix returns the formatted trace level for the text output.
+func traceLevelPrefix(traceLevel int) string {
+	if settingTraceHideLevel {
+		return ""
+	}
+	if settingTraceLevelFormat != nil {
+		return settingTraceLevelFormat(traceLevel)
+	}
+	return fmt.Sprintf("(%d)", traceLevel)
+}
+
+// SetMaxEmittedLevel caps the severity of log messages, which is useful for
+// sandboxed or test environments. Any message more severe than the given level
+// ("DEBUG", "INFO", "WARN", "ERROR" or "CRITICAL") is dropped or, if downgrade
+// is set, logged at the given level instead. Trace messages are not affected.
+// Fatal and friends don't exit the program, if their message is dropped or
+// downgraded, so that a sandboxed program can't terminate itself this way.
+// An empty level removes the cap.
+func SetMaxEmittedLevel(level string, downgrade bool) error {
+	maxLevel := levelNone
+	if level != "" {
+		var ok bool
+		maxLevel, ok = levelNumbers[strings.ToUpper(level)]
+		if !ok || maxLevel == levelTrace || maxLevel == levelNone {
+			return fmt.Errorf("illegal log level '%s'", level)
+		}
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingMaxLevel = maxLevel
+	settingMaxLevelDowngrade = downgrade
+	return nil
+}
+
+// SetGlobalMinLevel sets a global minimum level ("DEBUG", "INFO", "WARN",
+// "ERROR" or "CRITICAL"). Messages less severe than that are dropped right
+// away, before the caller is determined and before any filters are evaluated.
+// This is a coarse, but very cheap gate for high-throughput programs, which
+// don't need per-file log levels for verbose messages. Trace messages are not
+// affected. An empty level removes the minimum.
+func SetGlobalMinLevel(level string) error {
+	minLevel := levelNone
+	if level != "" {
+		var ok bool
+		minLevel, ok = levelNumbers[strings.ToUpper(level)]
+		if !ok || minLevel == levelTrace || minLevel == levelNone {
+			return fmt.Errorf("illegal log level '%s'", level)
+		}
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingMinLevel = minLevel
+	return nil
+}
+
+// EnableTrace sets the global trace level, without touching any per-file trace
+// filters. This is useful for quick, ad-hoc debugging, since no complete
+// RLOG_TRACE_LEVEL filter spec needs to be provided. The level stays in effect
+// even if the config file is re-read. A level above 1000 is the same as 1000.
+func EnableTrace(level int) {
+	if level < noTraceOutput {
+		level = noTraceOutput
+	} else if level > maxTraceLevel {
+		level = maxTraceLevel
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	traceLevelOverridden = true
+	traceLevelOverride = level
+	traceFilterSpec = traceFilterSpec.withGlobalLevel(level)
+}
+
+// EnableTraceForLoggedFiles enables trace messages up to the given level for all
+// files, which have a log level filter in RLOG_LOG_LEVEL that is more verbose
+// than the global log level. For example, with "WARN,server.go=DEBUG" tracing
+// is enabled for server.go. This keeps debugging focused on the files of
+// interest, without repeating them in RLOG_TRACE_LEVEL. Trace filters from
+// RLOG_TRACE_LEVEL take precedence. The setting stays in effect even if the
+// config file is re-read, and follows changes of the log filters. A level of
+// -1 turns it off again.
+func EnableTraceForLoggedFiles(level int) {
+	if level < noTraceOutput {
+		level = noTraceOutput
+	} else if level > maxTraceLevel {
+		level = maxTraceLevel
+	}
+	updateConfig(func(*rlogConfig) {
+		traceLoggedFilesEnabled = level != noTraceOutput
+		traceLoggedFilesLevel = level
+	})
+}
+
+// DisableTrace clears the global trace level. Any per-file trace filters
+// remain in effect.
+func DisableTrace() {
+	EnableTrace(noTraceOutput)
+}
+
+// levelCycle is the sequence of global log levels, which SIGUSR1 cycles
+// through if RLOG_SIGUSR1_CYCLE is set. TRACE stands for DEBUG plus all trace
+// messages.
+var levelCycle = []string{"WARN", "INFO", "DEBUG", "TRACE"}
+
+// levelCycleIndex is the position of the current global log level in
+// levelCycle. It's only used by the goroutine, which handles the signal.
+var levelCycleIndex = -1
+
+// startLevelCycle starts the cycle at the effective global log level and
+// installs the signal handler.
+func startLevelCycle() {
+	initMutex.RLock()
+	levelCycleIndex = currentLevelCycleIndex()
+	initMutex.RUnlock()
+	installLevelCycleHandler()
+}
+
+// currentLevelCycleIndex returns the position of the effective global log
+// level in levelCycle, or -1 if it's not part of the cycle. DEBUG together
+// with a global trace level counts as TRACE. The caller needs to hold
+// initMutex.
+func currentLevelCycleIndex() int {
+	level, ok := logFilterSpec.globalLevel()
+	if !ok {
+		return -1
+	}
+	current := levelStrings[level]
+	if _, tracing := traceFilterSpec.globalLevel(); tracing && level == levelDebug {
+		current = "TRACE"
+	}
+	for i, name := range levelCycle {
+		if name == current {
+			return i
+		}
+	}
+	return -1
+}
+
+// The global trace level, which was in effect before the level cycle entered
+// TRACE. It's restored when the cycle leaves TRACE again.
+var (
+	cycleTraceLevelOverridden bool
+	cycleTraceLevelOverride   int
+)
+
+// cycleLogLevel moves on to the next global log level in levelCycle and
+// returns its name. Like the level set via EnableTrace(), the global log level
+// replaces the one configured in RLOG_LOG_LEVEL, also when the config file is
+// re-read. Leaving TRACE restores the global trace level, which was in effect
+// before, whether it was configured via RLOG_TRACE_LEVEL or set via
+// EnableTrace().
+func cycleLogLevel() string {
+	var name string
+	updateConfig(func(*rlogConfig) {
+		wasTracing := levelCycleIndex >= 0 && levelCycle[levelCycleIndex] == "TRACE"
+		levelCycleIndex = (levelCycleIndex + 1) % len(levelCycle)
+		name = levelCycle[levelCycleIndex]
+		logLevelOverridden = true
+		if name == "TRACE" {
+			logLevelOverride = levelDebug
+			cycleTraceLevelOverridden = traceLevelOverridden
+			cycleTraceLevelOverride = traceLevelOverride
+			traceLevelOverridden = true
+			traceLevelOverride = maxTraceLevel
+		} else {
+			logLevelOverride = levelNumbers[name]
+			if wasTracing {
+				traceLevelOverridden = cycleTraceLevelOverridden
+				traceLevelOverride = cycleTraceLevelOverride
+			}
+		}
+	})
+	return name
+}
+
+// SetOutput re-wires the log output to a new io.Writer. By default rlog
+// logs to os.Stderr, but this function can be used to direct the output
+// somewhere else. If output to two destinations was specified via environment
+// variables then this will change it back to just one output.
+func SetOutput(writer io.Writer) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	discardOverridden = false
+	logWriterStream = log.New(writer, "", 0)
+	logWriterInfo = nil
+	closeLogFileWriter()
+	logWriterFile = nil
+	closeCurrentLogFile()
+}
+
+// syslogWriter is the connection to the system logger, which is used if
+// RLOG_LOG_STREAM is set to "syslog". It is opened once and then kept, so that
+// a changed configuration doesn't open a new connection each time.
+var syslogWriter io.Writer
+
+// SetSyslogOutput re-wires the log output to the system logger, just like
+// SetOutput. The tag is shown with each message. If it is empty then the name
+// of the program is used. Messages are sent with the INFO priority of the
+// user facility, the level is part of the message itself. An error is
+// returned if the system logger can't be reached, or if the platform has no
+// system logger. In that case the output is left unchanged. Setting
+// RLOG_LOG_STREAM to "syslog" does the same without any code.
+func SetSyslogOutput(tag string) error {
+	writer, err := openSyslog(tag)
+	if err != nil {
+		return err
+	}
+	SetOutput(writer)
+	return nil
+}
+
+// settingLineTransform is the transformation of log lines, as set via
+// SetLineTransform().
+var settingLineTransform func(line string) string
+
+// settingCallerSuffix is set if the caller info is shown at the end of the
+// line, as set via SetCallerPosition().
+var settingCallerSuffix bool
+
+// The components of the caller info, which can be selected via
+// RLOG_CALLER_FIELDS.
+const (
+	callerModule = 1 << iota
+	callerFile
+	callerLine
+	callerFunc
+	allCallerFields = callerModule | callerFile | callerLine | callerFunc
+)
+
+// Translation from the names in RLOG_CALLER_FIELDS to the components.
+var callerFieldNames = map[string]int{
+	"module": callerModule,
+	"file":   callerFile,
+	"line":   callerLine,
+	"func":   callerFunc,
+}
+
+// settingCallerFields holds the components of the caller info to log.
+var settingCallerFields = allCallerFields
+
+// parseCallerFields parses a comma separated list of caller info components.
+// An empty list selects all of them.
+func parseCallerFields(list string) (int, error) {
+	if strings.TrimSpace(list) == "" {
+		return allCallerFields, nil
+	}
+	fields := 0
+	for _, name := range strings.Split(list, ",") {
+		field, ok := callerFieldNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return allCallerFields, fmt.Errorf("unknown caller field '%s'", name)
+		}
+		fields |= field
+	}
+	return fields, nil
+}
+
+// SetCallerFields selects the components of the caller info, which are
+// logged: Any of "module", "file", "line" and "func". For example, "file" and
+// "line" give "[1234 example.go:27]" instead of
+// "[1234 examples/example.go:27 (main.main)]". Formatters only get the
+// selected components as well. An empty list selects all of them.
+func SetCallerFields(fields []string) error {
+	list := strings.Join(fields, ",")
+	if _, err := parseCallerFields(list); err != nil {
+		return err
+	}
+	updateConfig(func(config *rlogConfig) {
+		config.callerFields = list
+	})
+	return nil
+}
+
+// callerFields returns the file, line and function name of a call site, as
+// far as they were selected via RLOG_CALLER_FIELDS. Components, which weren't
+// selected, are empty.
+func callerFields(site *callerSite) (file string, line int, funcName string) {
+	switch settingCallerFields & (callerModule | callerFile) {
+	case callerModule | callerFile:
+		file = site.file
+	case callerFile:
+		file = path.Base(site.file)
+	case callerModule:
+		file = path.Dir(site.file)
+	}
+	if settingCallerFields&callerLine != 0 {
+		line = site.line
+	}
+	if settingCallerFields&callerFunc != 0 {
+		funcName = site.funcName
+	}
+	return file, line, funcName
+}
+
+// formatCallerInfo formats the caller info of the text output, consisting of
+// the process ID, the goroutine ID if enabled, and the selected components of
+// the call site.
+func formatCallerInfo(site *callerSite) string {
+	info := "[" + strconv.Itoa(os.Getpid())
+	if settingShowGoroutineID {
+		info += ":" + strconv.FormatUint(getGID(), 10)
+	}
+	file, line, funcName := callerFields(site)
+	showLine := settingCallerFields&callerLine != 0
+	if file != "" || showLine {
+		info += " " + file
+		if showLine {
+			if file != "" {
+				info += ":"
+			}
+			info += strconv.Itoa(line)
+		}
+	}
+	if funcName != "" {
+		info += " (" + funcName + ")"
+	}
+	return info + "] "
+}
+
+// SetCallerPosition sets where the caller info is shown in the text output:
+// Either before the message ("prefix", the default) or at the end of the line
+// ("suffix"), after the message and its fields. Output through a Formatter
+// isn't affected.
+func SetCallerPosition(position string) error {
+	var suffix bool
+	switch strings.ToLower(position) {
+	case "prefix":
+	case "suffix":
+		suffix = true
+	default:
+		return fmt.Errorf("illegal caller info position '%s'", position)
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingCallerSuffix = suffix
+	return nil
+}
+
+// settingLinePrefix is the string set via SetLinePrefix().
+var settingLinePrefix string
+
+// SetLinePrefix sets a constant string, which is written at the start of every
+// log line, before the time stamp. Some log aggregators need such a tag to
+// route the messages. The prefix is also added to lines produced by a
+// Formatter. It applies to all outputs, stream and logfile alike. An empty
+// string removes the prefix.
+func SetLinePrefix(prefix string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingLinePrefix = prefix
+}
+
+// settingArgSeparator is the separator set via SetArgSeparator().
+var settingArgSeparator = " "
+
+// SetArgSeparator sets the string, which is put between the arguments of the
+// log functions without format string. By default this is a single space, as
+// with fmt.Sprintln. An empty separator joins the arguments directly.
+func SetArgSeparator(separator string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingArgSeparator = separator
+}
+
+// settingUnknownLevelName is the name set via SetUnknownLevelName().
+var settingUnknownLevelName = "LOG"
+
+// SetUnknownLevelName sets the name, which is shown for messages logged via
+// LogLevel() at a level that isn't known. By default this is "LOG".
+func SetUnknownLevelName(name string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingUnknownLevelName = name
+}
+
+// settingExpandStructs is the flag set via SetExpandStructs().
+var settingExpandStructs bool
+
+// SetExpandStructs enables or disables the expansion of struct and map
+// arguments in the text output. If enabled, Info(myStruct) logs the fields of
+// the struct as sorted 'key=value' pairs, rather than as '{a b c}'. This is
+// easier to read, especially for structs with many fields. Only the top level
+// is expanded, nested values are shown as usual. This applies to the log
+// functions without format string, and not if a Formatter is set.
+func SetExpandStructs(expand bool) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingExpandStructs = expand
+}
+
+// settingSkipEmpty is the flag set via SetSkipEmpty().
+var settingSkipEmpty bool
+
+// SetSkipEmpty determines whether empty messages are dropped. A message is
+// empty if it has neither text nor fields, as is the case for Info() or
+// Infof(""), which are usually accidental. By default, empty messages are
+// logged like any other message, so that the line shows just the time stamp and
+// the level.
+func SetSkipEmpty(skip bool) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingSkipEmpty = skip
+}
+
+// SetLineTransform sets a function, which transforms each log line right
+// before it is written. It runs after the line was fully assembled, including
+// any formatting by a Formatter, and only once per message, no matter to how
+// many outputs the line is written. This is a catch-all for any special needs
+// of the output, for example to prepend a tag or to mask sensitive data. The
+// line is passed without trailing newline. If the function returns an empty
+// string, the line is skipped. A nil function disables the transformation.
+func SetLineTransform(fn func(line string) string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingLineTransform = fn
+}
+
+// settingSourceTrim is the prefix of source file paths, which is removed from
+// the logged file names, as set via SetSourceTrim().
+var settingSourceTrim string
+
+// SetSourceTrim sets a prefix, which is removed from the path of the source
+// files in the caller info, for example the path of your module root. Source
+// files within that prefix are then shown with their path relative to it,
+// such as "internal/auth/handler.go", instead of just the last directory and
+// the file name. The prefix is a directory, so "/src/mod" doesn't apply to
+// "/src/module/main.go". An empty prefix restores the default.
+//
+// The trimmed path is only used for the caller info and the file name, which
+// is passed to a FilterFunc. Per-file filters from RLOG_LOG_LEVEL and
+// RLOG_TRACE_LEVEL still only match the file name without any directory.
+func SetSourceTrim(prefix string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingSourceTrim = strings.TrimSuffix(strings.Replace(prefix, `\`, "/", -1), "/")
+	resetCallerSites()
+}
+
+// SetClock replaces the clock, which rlog uses for time stamps and all time
+// based calculations, such as the interval for checking the config file. This
+// is meant for tests, which need deterministic time stamps or want to advance
+// the time. Passing nil restores the system clock.
+func SetClock(fn func() time.Time) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	if fn == nil {
+		fn = time.Now
+	}
+	clock = fn
+}
+
+// currentTime returns the time of rlog's clock, for use outside of initMutex.
+func currentTime() time.Time {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	return clock()
+}
+
+// SetTraceOutput sends trace messages to the given io.Writer, instead of the
+// normal log output. This keeps high-volume trace output apart from the other
+// log messages. Passing nil sends trace messages to the normal log output
+// again.
+func SetTraceOutput(writer io.Writer) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	if writer == nil {
+		logWriterTrace = nil
+	} else {
+		logWriterTrace = log.New(writer, "", 0)
+	}
+}
+
+// Discard switches off all log output. Any logfile is closed. This is kept
+// when the config file is read again, until log output is enabled again with
+// SetOutput() or the entire configuration is replaced via Reconfigure().
+func Discard() {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	discardOverridden = true
+	logWriterStream = nil
+	logWriterInfo = nil
+	closeLogFileWriter()
+	logWriterFile = nil
+	closeCurrentLogFile()
+}
+
+// IsDiscarding returns true if log output isn't sent anywhere, for example
+// because RLOG_LOG_STREAM is set to "none" and no logfile is configured.
+// Performance sensitive code can use this to skip the preparation of data,
+// which is only needed for log messages.
+func IsDiscarding() bool {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	return isDiscarding()
+}
+
+// isDiscarding does the actual work for IsDiscarding(). The caller needs to
+// hold initMutex.
+func isDiscarding() bool {
+	return (logWriterStream == nil || logWriterStream.Writer() == io.Discard) &&
+		logWriterFile == nil && logWriterTrace == nil &&
+		settingOTelExporter == nil && len(recordHooks) == 0 &&
+		channelOutput == nil && logWriterErrorFile == nil
+}
+
+// SetFailover re-wires the log output, similar to SetOutput. All output is sent
+// to the primary writer, but if a write to the primary fails then that line is
+// written to the fallback writer instead. The primary writer is tried again for
+// every line, so that output returns to it as soon as it has recovered. This is
+// useful for unreliable outputs, such as remote collectors.
+func SetFailover(primary io.Writer, fallback io.Writer) {
+	SetOutput(&failoverWriter{primary: primary, fallback: fallback})
+}
+
+// failoverWriter is the io.Writer used by SetFailover. Writes are serialized by
+// the log.Logger that wraps it, so no locking is needed here.
+type failoverWriter struct {
+	primary  io.Writer
+	fallback io.Writer
+	failing  bool // whether the last write to the primary writer failed
+}
+
+// Write writes to the primary writer, or to the fallback writer if that fails.
+// Failure and recovery of the primary writer are reported once each.
+func (w *failoverWriter) Write(p []byte) (int, error) {
+	n, err := w.primary.Write(p)
+	if err == nil {
+		if w.failing {
+			w.failing = false
+			rlogIssue("Primary log output recovered.")
+		}
+		return n, nil
+	}
+	if !w.failing {
+		w.failing = true
+		rlogIssue("Writing to primary log output failed: %s. Using fallback.", err)
+	}
+	return w.fallback.Write(p)
+}
+
+// openLogFile opens the logfile with the given name for appending. It is
+// created if needed.
+func openLogFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+// ReopenLogFile closes the logfile and opens it again under its configured
+// name. This is needed after an external tool, such as logrotate, renamed the
+// logfile: Without reopening, rlog would continue to write to the renamed
+// file. Buffered output is written to the old file first. If the logfile was
+// given up after a write error, it's used again, and buffered output, which
+// couldn't be written, is dropped. The file set via SetErrorFile() is reopened
+// as well. Nothing is done if neither is configured. See also
+// RLOG_SIGHUP_REOPEN.
+func ReopenLogFile() error {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	var err error
+	if w := currentLogFileWriter(); w != nil {
+		err = reopenLogFileWriter(w)
+	}
+	if logWriterErrorFile != nil {
+		w := logWriterErrorFile.Writer().(*logFileWriter)
+		if errorFileErr := reopenLogFileWriter(w); err == nil {
+			err = errorFileErr
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to reopen log file: %s", err)
+		setLastError(err)
+		return err
+	}
+	return nil
+}
+
+// reopenLogFileWriter flushes the buffer of the writer, if any, and opens its
+// file again. The caller needs to hold the write lock of initMutex.
+func reopenLogFileWriter(w *logFileWriter) error {
+	// The background flushing may write to the file at any time, so the
+	// buffer's mutex is needed to replace it.
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.buf != nil {
+		w.buf.Flush()
+	}
+	err := w.reopen()
+	if err == nil && w.buf != nil {
+		// Errors of a bufio.Writer are sticky, so it's reset to write to
+		// the new file. Output, which couldn't be written before, is lost.
+		w.buf.Reset(writerFunc(w.writeFile))
+	}
+	return err
+}
+
+// closeCurrentLogFile closes the logfile currently in use, after its writer
+// was closed. The caller needs to hold the write lock of initMutex.
+func closeCurrentLogFile() {
+	currentLogFileMutex.Lock()
+	defer currentLogFileMutex.Unlock()
+	if currentLogFile != nil {
+		currentLogFile.Close()
+		currentLogFile = nil
+	}
+	currentLogFileName = ""
+}
+
+// settingFileHeader is the header line for new logfiles, as set via
+// SetFileHeader().
+var settingFileHeader string
+
+// SetFileHeader sets a header line, which is written at the start of each new
+// logfile, for example to describe the columns for CSV style log processing.
+// The header is only written to empty files, never to a logfile, which already
+// has content. If the current logfile is still empty, the header is written
+// to it right away. An empty header disables this again.
+func SetFileHeader(header string) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingFileHeader = header
+	if w := currentLogFileWriter(); w != nil {
+		writeFileHeader(w.file)
+	}
+}
+
+// writeFileHeader writes the header line to the logfile, if one is set and
+// the logfile is empty.
+func writeFileHeader(file *os.File) {
+	if settingFileHeader == "" {
+		return
+	}
+	if info, err := file.Stat(); err != nil || info.Size() > 0 {
+		return
+	}
+	header := settingFileHeader
+	if !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+	file.WriteString(header)
+}
+
+// How often buffered output for the logfile is written to the file, as set
+// via SetFlushInterval(). Zero disables the periodic flushing.
+var settingFlushInterval = time.Second
+
+// SetFlushInterval sets how often buffered output is written to the logfile.
+// The default is once per second. A shorter interval limits how much output
+// is lost if the program crashes, a longer one reduces the number of writes.
+// Zero disables the periodic flushing, so that output is only written when
+// the buffer is full or Flush() is called. This only matters if buffering is
+// enabled via RLOG_LOG_FILE_BUFFER_KB.
+func SetFlushInterval(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingFlushInterval = d
+	if w := currentLogFileWriter(); w != nil && w.buf != nil {
+		w.stopFlushing()
+		w.startFlushing()
+	}
+}
+
+// logFileWriter is the io.Writer for the logfile. If a write fails, for
+// example because the file was deleted or the disk is full, the file is opened
+// again once. If that doesn't help either, the writer gives up and returns an
+// error for all further writes, so that basicLog can fall back to a stream.
+// Writes are serialized by the log.Logger that wraps it. Only the optional
+// buffer needs its own lock, since it's also flushed in the background.
+type logFileWriter struct {
+	name   string   // name of the logfile
+	file   *os.File // the logfile
+	failed bool     // whether we gave up on the logfile
+
+	mutex sync.Mutex    // protects the buffer
+	buf   *bufio.Writer // buffer for the logfile, if enabled
+	stop  chan struct{} // closed to stop the background flushing
+}
+
+// newLogFileWriter returns a writer for the given logfile. If the buffer size
+// is greater than zero, output is buffered and written to the file
+// periodically.
+func newLogFileWriter(name string, file *os.File, bufferSize int) *logFileWriter {
+	w := &logFileWriter{name: name, file: file}
+	if bufferSize > 0 {
+		w.buf = bufio.NewWriterSize(writerFunc(w.writeFile), bufferSize)
+		w.startFlushing()
+	}
+	return w
+}
+
+// isCurrentFile checks whether the file of the writer is still the one with
+// its name, rather than having been removed or replaced.
+func (w *logFileWriter) isCurrentFile() bool {
+	info, err := os.Stat(w.name)
+	if err != nil {
+		return false
+	}
+	openInfo, err := w.file.Stat()
+	return err == nil && os.SameFile(info, openInfo)
+}
+
+// bufferSize returns the size of the buffer of the writer, or zero if output
+// isn't buffered.
+func (w *logFileWriter) bufferSize() int {
+	if w.buf == nil {
+		return 0
+	}
+	return w.buf.Size()
+}
+
+// startFlushing starts the background flushing of the buffer, unless it's
+// disabled. The caller needs to hold the write lock of initMutex.
+func (w *logFileWriter) startFlushing() {
+	if settingFlushInterval > 0 {
+		w.stop = make(chan struct{})
+		go w.flushPeriodically(w.stop, settingFlushInterval)
+	}
+}
+
+// stopFlushing stops the background flushing of the buffer. The caller needs
+// to hold the write lock of initMutex.
+func (w *logFileWriter) stopFlushing() {
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+// currentLogFileWriter returns the writer of the current logfile, or nil if
+// there is none. The caller needs to hold initMutex.
+func currentLogFileWriter() *logFileWriter {
+	if logWriterFile == nil {
+		return nil
+	}
+	w, _ := logWriterFile.Writer().(*logFileWriter)
+	return w
+}
+
+// closeLogFileWriter flushes the writer of the current logfile and stops its
+// background flushing, before it's replaced. The caller needs to hold the
+// write lock of initMutex.
+func closeLogFileWriter() {
+	if w := currentLogFileWriter(); w != nil {
+		w.stopFlushing()
+		w.flush()
+	}
+}
+
+// The additional logfile set via SetErrorFile(), and the least severe level
+// written to it.
+var (
+	logWriterErrorFile    *log.Logger
+	settingErrorFileLevel int
+)
+
+// SetErrorFile opens an additional logfile, which receives a copy of all
+// messages at the given level ("DEBUG", "INFO", "WARN", "ERROR" or
+// "CRITICAL") or more severe ones. The normal output is not affected. This
+// allows errors to be collected in a dedicated file, for example for
+// auditing. Trace messages are never written to this file. Like the logfile,
+// it's reopened by ReopenLogFile(). An empty name closes the file again.
+func SetErrorFile(name string, minLevel string) error {
+	var newLogger *log.Logger
+	level := levelNone
+	if name != "" {
+		var ok bool
+		level, ok = levelNumbers[strings.ToUpper(minLevel)]
+		if !ok || level == levelTrace || level == levelNone {
+			return fmt.Errorf("illegal log level '%s'", minLevel)
+		}
+		file, err := openLogFile(name)
+		if err != nil {
+			return err
+		}
+		writeFileHeader(file)
+		newLogger = log.New(newLogFileWriter(name, file, 0), "", 0)
+	}
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	if logWriterErrorFile != nil {
+		logWriterErrorFile.Writer().(*logFileWriter).file.Close()
+	}
+	logWriterErrorFile = newLogger
+	settingErrorFileLevel = level
+	return nil
+}
+
+// Flush writes any buffered output to the logfile. Output is only buffered if
+// this is enabled via RLOG_LOG_FILE_BUFFER_KB.
+func Flush() error {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	if w := currentLogFileWriter(); w != nil {
+		return w.flush()
+	}
+	return nil
+}
+
+// RegisterExitFlush flushes any buffered output when the program receives
+// SIGINT or SIGTERM. Go has no exit handlers, so otherwise output buffered via
+// RLOG_LOG_FILE_BUFFER_KB is lost if the program is terminated by a signal.
+// If terminate is true, the signal then takes its default action, which
+// terminates the program. A program, which handles these signals itself,
+// passes false: Signals are delivered to all channels registered via
+// signal.Notify, so its own handler still gets them and decides what happens.
+// The returned function stops the flushing on signals again.
+func RegisterExitFlush(terminate bool) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, exitSignals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				Flush()
+				if terminate {
+					signal.Stop(signals)
+					raiseSignal(sig)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// flushPeriodically flushes the buffer of the writer at the given interval,
+// until the stop channel is closed.
+func (w *logFileWriter) flushPeriodically(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			initMutex.RLock()
+			w.flush()
+			initMutex.RUnlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// flush writes the buffered output to the logfile.
+func (w *logFileWriter) flush() error {
+	if w.buf == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.Flush()
+}
+
+// Write writes to the logfile, or to the buffer if enabled.
+func (w *logFileWriter) Write(p []byte) (int, error) {
+	if w.buf == nil {
+		return w.writeFile(p)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.Write(p)
+}
+
+// reopen opens the logfile again and replaces the file of the writer with it.
+// The old file is closed. This is the only place, where the file of a writer
+// is replaced, and it keeps currentLogFile up to date, if that refers to the
+// old file. The caller needs to hold w.mutex if the output is buffered.
+// Otherwise, writes are serialized by the log.Logger, and ReopenLogFile()
+// holds the write lock of initMutex.
+func (w *logFileWriter) reopen() error {
+	file, err := openLogFile(w.name)
+	if err != nil {
+		return err
+	}
+	writeFileHeader(file)
+	oldFile := w.file
+	w.file = file
+	w.failed = false
+	oldFile.Close()
+
+	currentLogFileMutex.Lock()
+	defer currentLogFileMutex.Unlock()
+	if currentLogFile == oldFile {
+		currentLogFile = file
+	}
+	return nil
+}
+
+// writeFile writes to the logfile, opening it again if needed.
+func (w *logFileWriter) writeFile(p []byte) (int, error) {
+	if w.failed {
+		return 0, fmt.Errorf("log file %s disabled after write error", w.name)
+	}
+	n, err := w.file.Write(p)
+	if err == nil {
+		return n, nil
+	}
+	// The whole line is written to the reopened file, even if part of it
+	// made it into the old one, so that the new file has no torn lines.
+	if w.reopen() == nil {
+		if _, err = w.file.Write(p); err == nil {
+			return len(p), nil
+		}
+	}
+	w.failed = true
+	err = fmt.Errorf("writing to log file %s failed: %s", w.name, err)
+	rlogIssue("%s. Log file output disabled.", err)
+	setLastError(err)
+	return 0, err
+}
+
+// writerFunc turns a function into an io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+// Write calls the function.
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// LastError returns the last error, which occurred while writing log output
+// or opening the logfile. It returns nil if there was no error.
+func LastError() error {
+	lastErrorMutex.Lock()
+	defer lastErrorMutex.Unlock()
+	return lastError
+}
+
+// setLastError records an error for LastError().
+func setLastError(err error) {
+	lastErrorMutex.Lock()
+	defer lastErrorMutex.Unlock()
+	lastError = err
+}
+
+// isBoolString tests whether a string represents a boolean value, either
+// 'true' or 'false'.
+func isBoolString(str string) bool {
+	return isTrueBoolString(str) || isFalseBoolString(str)
+}
+
+// isTrueBoolString tests a string to see if it represents a 'true' value.
+// The ParseBool function unfortunately doesn't recognize 'y', 'yes' or 'on',
+// which is why we added that test here as well.
+func isTrueBoolString(str string) bool {
+	str = strings.ToUpper(str)
+	if str == "Y" || str == "YES" || str == "ON" {
+		return true
+	}
+	if isTrue, err := strconv.ParseBool(str); err == nil && isTrue {
+		return true
+	}
+	return false
+}
+
+// isFalseBoolString tests a string to see if it represents an explicit 'false'
+// value. An empty string is neither 'true' nor 'false', which allows to tell
+// unset flags apart from disabled ones.
+func isFalseBoolString(str string) bool {
+	str = strings.ToUpper(str)
+	if str == "N" || str == "NO" || str == "OFF" {
+		return true
+	}
+	if isTrue, err := strconv.ParseBool(str); err == nil && !isTrue {
+		return true
 	}
 	return false
 }
 
+// getHostname returns the host name to be logged. This is the host name
+// configured via RLOG_HOSTNAME or, if that is not set, the host name reported
+// by the kernel. If the latter can't be determined, we warn once and use
+// 'unknown' instead.
+func getHostname() string {
+	if settingHostname != "" {
+		return settingHostname
+	}
+	kernelHostnameOnce.Do(func() {
+		var err error
+		kernelHostname, err = os.Hostname()
+		if err != nil || kernelHostname == "" {
+			rlogIssue("Unable to determine host name (%v). Using 'unknown'.", err)
+			kernelHostname = "unknown"
+		}
+	})
+	return kernelHostname
+}
+
 // rlogIssue is used by rlog itself to report issues or problems. This is mostly
 // independent of the standard logging settings, since a problem may have
 // occurred while trying to establish the standard settings. So, where can rlog
@@ -554,60 +2600,118 @@ func rlogIssue(prefix string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, fmtStr, a...)
 }
 
+// logExtras holds additional settings for a single log call, which are only
+// supplied by some of the log functions. For all others, this is nil.
+type logExtras struct {
+	time          time.Time // time stamp to log, instead of the current time
+	debugFallback bool      // log trace messages, which aren't traced, as debug
+	unknownLevel  bool      // the level isn't known, show the unknown level name
+	fields        Fields    // fields to log with the message
+	capped        bool      // set by basicLog, if the maximum level applied
+}
+
+// callerSite holds the caller information of a call site of the log functions.
+type callerSite struct {
+	funcName string // name of the calling function
+	file     string // module and file name
+	line     int    // line number
+	info     string // prepared caller info for the log line, if not empty
+}
+
+// unknownCallerSite is used if the caller information can't be determined.
+var unknownCallerSite = &callerSite{funcName: "unknown", file: "unknown"}
+
 // basicLog is called by all the 'level' log functions.
 // It checks what is configured to be included in the log message, decorates it
 // accordingly and assembles the entire line. It then uses the standard log
 // package to finally output the message.
-func basicLog(logLevel int, traceLevel int, isLocked bool, format string, prefixAddition string, a ...interface{}) {
-	now := time.Now()
-
+func basicLog(logLevel int, traceLevel int, isLocked bool, extras *logExtras, format string, prefixAddition string, a ...interface{}) {
 	// In some cases the caller already got this lock for us
 	if !isLocked {
+		if isRecursiveLog() {
+			return
+		}
 		initMutex.RLock()
 		defer initMutex.RUnlock()
 	}
 
+	now := clock()
+	logTime := now
+	if extras != nil && !extras.time.IsZero() {
+		logTime = extras.time
+	}
+
 	// Check if it's time to load updated information from the config file
 	if settingCheckInterval > 0 && now.Sub(lastConfigFileCheck) > settingCheckInterval {
 		// This unlock always happens, since initMutex is locked at this point,
 		// either by this function or the caller Initialize needs to be able to
 		initMutex.RUnlock()
 		// Get the full lock, so we need to release ours.
-		initialize(configFromEnvVars, false)
+		reloadConfig()
 		// Take our reader lock again. This is fine, since only the check
 		// interval related items were read earlier.
 		initMutex.RLock()
 	}
 
-	// Extract information about the caller of the log function, if requested.
-	var callingFuncName string
-	var moduleAndFileName string
-	pc, fullFilePath, line, ok := runtime.Caller(2)
-	if ok {
-		callingFuncName = runtime.FuncForPC(pc).Name()
-		// We only want to print or examine file and package name, so use the
-		// last two elements of the full path. The path package deals with
-		// different path formats on different systems, so we use that instead
-		// of just string-split.
-		dirPath, fileName := path.Split(fullFilePath)
-		var moduleName string
-		if dirPath != "" {
-			dirPath = dirPath[:len(dirPath)-1]
-			_, moduleName = path.Split(dirPath)
+	// Messages more severe than the configured maximum level are dropped or
+	// downgraded to that level. Trace messages are never affected. A message
+	// is more severe, if a message at the maximum level wouldn't be logged
+	// with the level of the message configured. This is reported back via
+	// the extras, even if nothing is logged, so that Fatal and friends don't
+	// exit the program then.
+	if settingMaxLevel != levelNone && !levelEnabled(settingMaxLevel, logLevel) {
+		if extras != nil {
+			extras.capped = true
+		}
+		if !settingMaxLevelDowngrade {
+			atomic.AddUint64(&suppressedCount, 1)
+			return
 		}
-		moduleAndFileName = moduleName + "/" + fileName
+		logLevel = settingMaxLevel
+	}
+
+	// Nothing else needs to be done if the output goes nowhere, or if the
+	// message is below the global minimum level.
+	if isDiscarding() && !hasExtraOutput(a) {
+		return
+	}
+	if settingMinLevel != levelNone && traceLevel == notATrace && !levelEnabled(logLevel, settingMinLevel) {
+		return
+	}
+
+	// Extract information about the caller of the log function.
+	site, ok := getCaller(2)
+	if !ok {
+		// Without caller information we can't tell where the message came
+		// from. A placeholder is shown and only the global level decides
+		// whether this message is logged.
+		site = unknownCallerSite
 	}
 
 	// Perform tests to see if we should log this message.
+	matches := func(spec *filterSpec, fn FilterFunc, level int) bool {
+		if ok {
+			if fn != nil {
+				if matched, allow := fn(site.file, site.funcName, level); matched {
+					return allow
+				}
+			}
+			return spec.matchfilters(site.file, site.funcName, level)
+		}
+		return spec.matchGlobalFilter(level)
+	}
 	var allowLog bool
-	if traceLevel == notATrace {
-		if logFilterSpec.matchfilters(moduleAndFileName, logLevel) {
-			allowLog = true
+	if traceLevel != notATrace {
+		allowLog = matches(traceFilterSpec, settingTraceFilterFunc, traceLevel)
+		// A trace message, which isn't traced, may still be logged as a
+		// debug message instead.
+		if !allowLog && extras != nil && extras.debugFallback {
+			logLevel, traceLevel, prefixAddition = levelDebug, notATrace, ""
+			allowLog = (settingMinLevel == levelNone || levelEnabled(logLevel, settingMinLevel)) &&
+				matches(logFilterSpec, settingFilterFunc, logLevel)
 		}
 	} else {
-		if traceFilterSpec.matchfilters(moduleAndFileName, traceLevel) {
-			allowLog = true
-		}
+		allowLog = matches(logFilterSpec, settingFilterFunc, logLevel)
 	}
 	if !allowLog {
 		return
@@ -615,31 +2719,286 @@ func basicLog(logLevel int, traceLevel int, isLocked bool, format string, prefix
 
 	callerInfo := ""
 	if settingShowCallerInfo {
-		if settingShowGoroutineID {
-			callerInfo = fmt.Sprintf("[%d:%d %s:%d (%s)] ", os.Getpid(),
-				getGID(), moduleAndFileName, line, callingFuncName)
+		if site.info != "" && !settingShowGoroutineID && settingCallerFields == allCallerFields {
+			callerInfo = site.info
 		} else {
-			callerInfo = fmt.Sprintf("[%d %s:%d (%s)] ", os.Getpid(),
-				moduleAndFileName, line, callingFuncName)
+			callerInfo = formatCallerInfo(site)
 		}
 	}
 
+	// Field arguments, created with F(), aren't part of the message.
+	var fields Fields
+	if extras != nil {
+		fields = extras.fields
+	}
+	var extraOutputs []io.Writer
+	a, fields, extraOutputs = splitFields(a, fields)
+
 	// Assemble the actual log line
-	var msg string
-	if format != "" {
-		msg = fmt.Sprintf(format, a...)
+	msg := formatMessage(format, a)
+	levelName := levelStrings[logLevel]
+	unknownLevel := extras != nil && extras.unknownLevel
+	if unknownLevel {
+		levelName = settingUnknownLevelName
+	}
+	record := Record{
+		Time:       logTime,
+		Level:      levelName,
+		TraceLevel: traceLevel,
+		Message:    strings.TrimSuffix(msg, "\n"),
+		Version:    settingVersion,
+		Fields:     fields,
+		level:      logLevel,
+	}
+	if settingSkipEmpty && record.Message == "" && len(fields) == 0 {
+		return
+	}
+	// The sequence number is only taken now, after filtering, so that there
+	// are no gaps in the sequence of logged messages.
+	if settingShowSeq {
+		record.Seq = atomic.AddUint64(&logSequence, 1)
+	}
+	var timeStamp string
+	if settingTimeSeq {
+		timeStamp = logTime.Format(settingDateTimeFormat)
+		record.TimeSeq = nextTimeSeq(timeStamp)
+	}
+	atomic.AddUint64(&levelCounts[logLevel], 1)
+	if settingShowCallerInfo && ok {
+		record.File, record.Line, record.Func = callerFields(site)
+	}
+	// From here on, code of the program may be called, which might log
+	// something itself.
+	if callsProgramCode() {
+		defer guardRecursion()()
+	}
+	callRecordHooks(record)
+	if settingOTelExporter != nil {
+		exportOTel(record)
+	}
+
+	var logLine string
+	if settingFormatter != nil {
+		logLine = formatRecord(record)
+		if logLine == "" {
+			return
+		}
 	} else {
-		msg = fmt.Sprintln(a...)
+		seqInfo := ""
+		if settingShowSeq {
+			seqInfo = "#" + strconv.FormatUint(record.Seq, 10) + " "
+		}
+		hostInfo := ""
+		if settingShowHostname {
+			hostInfo = "[" + getHostname() + "] "
+		}
+		if settingLevelNumbers != nil && !unknownLevel {
+			levelName = settingLevelNumbers[logLevel]
+		}
+		levelDecoration := levelPrefixes[logLevel] + levelName + prefixAddition
+		callerPrefix, callerSuffix := callerInfo, ""
+		if settingCallerSuffix && callerInfo != "" {
+			callerPrefix, callerSuffix = "", " "+strings.TrimSuffix(callerInfo, " ")
+		}
+		if settingTimeSeq {
+			timeStamp += "[" + strconv.FormatUint(record.TimeSeq, 10) + "] "
+		} else {
+			timeStamp = logTime.Format(settingDateTimeFormat)
+		}
+		// The log writers add the final newline
+		logLine = fmt.Sprintf("%s%s%s%s%-9s: %s%s%s%s", seqInfo,
+			timeStamp, hostInfo, settingVersionPrefix,
+			levelDecoration, callerPrefix, record.Message, textFields(record.Fields),
+			callerSuffix)
+	}
+	logLine = settingLinePrefix + logLine
+	if settingLineTransform != nil {
+		if logLine = settingLineTransform(logLine); logLine == "" {
+			return
+		}
 	}
-	levelDecoration := levelStrings[logLevel] + prefixAddition
-	logLine := fmt.Sprintf("%s%-9s: %s%s",
-		now.Format(settingDateTimeFormat), levelDecoration, callerInfo, msg)
-	if logWriterStream != nil {
-		logWriterStream.Print(logLine)
+	for _, w := range extraOutputs {
+		io.WriteString(w, logLine+"\n")
+	}
+	if traceLevel != notATrace && logWriterTrace != nil {
+		writeOutput(logWriterTrace, outputTrace, logLine)
+		return
+	}
+	stream := logWriterStream
+	if logWriterInfo != nil && !levelEnabled(logLevel, levelWarn) {
+		stream = logWriterInfo
+	}
+	if stream != nil {
+		writeOutput(stream, outputStream, logLine)
 	}
 	if logWriterFile != nil {
-		logWriterFile.Print(logLine)
+		// If the logfile can't be written, the line still needs to go
+		// somewhere. Unless it was already written to a stream, we use
+		// stderr.
+		if err := writeOutput(logWriterFile, outputFile, logLine); err != nil && logWriterStream == nil {
+			log.New(os.Stderr, "", 0).Print(logLine)
+		}
+	}
+	if logWriterErrorFile != nil && levelEnabled(logLevel, settingErrorFileLevel) {
+		writeOutput(logWriterErrorFile, outputErrorFile, logLine)
+	}
+}
+
+// formatMessage formats the arguments of a log function as message. fmt
+// recovers from panics in the String() or Error() methods of the arguments,
+// but not from all of them, for example if the panic value itself can't be
+// printed. A log call must never crash the program, so any remaining panic is
+// recovered here and a placeholder is logged instead of the message.
+func formatMessage(format string, a []interface{}) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprintf("%%!PANIC(formatting error: %T)", r)
+		}
+	}()
+	if format != "" {
+		return fmt.Sprintf(format, a...)
+	}
+	if settingExpandStructs && settingFormatter == nil {
+		a = expandStructs(a)
+	}
+	if settingArgSeparator == " " {
+		return fmt.Sprintln(a...)
+	}
+	args := make([]string, len(a))
+	for i, arg := range a {
+		args[i] = fmt.Sprint(arg)
+	}
+	return strings.Join(args, settingArgSeparator)
+}
+
+// formatRecord renders the record with the selected Formatter. If the
+// formatter panics, the message is logged in rlog's own format instead,
+// together with a note about the panic.
+func formatRecord(r Record) (line string) {
+	defer func() {
+		if p := recover(); p != nil {
+			line = fmt.Sprintf("%-9s: %s %%!PANIC(formatter error: %T)", r.Level, r.Message, p)
+		}
+	}()
+	return settingFormatter.Format(r)
+}
+
+// splitFields separates the Field and ExtraOutput arguments of a log function
+// from the other arguments. The fields are added to the given fields, without
+// modifying them. If there are no such arguments, the arguments and fields are
+// returned unchanged.
+func splitFields(a []interface{}, fields Fields) ([]interface{}, Fields, []io.Writer) {
+	numFields, numOutputs := 0, 0
+	for _, arg := range a {
+		switch arg.(type) {
+		case Field:
+			numFields++
+		case ExtraOutput:
+			numOutputs++
+		}
+	}
+	if numFields+numOutputs == 0 {
+		return a, fields, nil
+	}
+	args := make([]interface{}, 0, len(a)-numFields-numOutputs)
+	allFields := fields
+	if numFields > 0 {
+		allFields = make(Fields, len(fields)+numFields)
+		for k, v := range fields {
+			allFields[k] = v
+		}
+	}
+	var outputs []io.Writer
+	for _, arg := range a {
+		switch arg := arg.(type) {
+		case Field:
+			allFields[arg.Key] = arg.Value
+		case ExtraOutput:
+			if arg.w != nil {
+				outputs = append(outputs, arg.w)
+			}
+		default:
+			args = append(args, arg)
+		}
+	}
+	return args, allFields, outputs
+}
+
+// hasExtraOutput returns true if one of the arguments of a log function is an
+// ExtraOutput.
+func hasExtraOutput(a []interface{}) bool {
+	for _, arg := range a {
+		if _, ok := arg.(ExtraOutput); ok {
+			return true
+		}
 	}
+	return false
+}
+
+// textFields renders fields for the text output, as ' key=value' pairs, in
+// alphabetical order of the keys.
+func textFields(fields Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	for _, k := range fields.sortedKeys() {
+		fmt.Fprintf(&buf, " %s=%v", k, fields[k])
+	}
+	return buf.String()
+}
+
+// expandStructs returns the log function arguments with any structs and maps
+// replaced by their 'key=value' pairs, as rendered by expandStruct. The
+// original slice isn't modified.
+func expandStructs(a []interface{}) []interface{} {
+	var expanded []interface{}
+	for i, arg := range a {
+		if s, ok := expandStruct(arg); ok {
+			if expanded == nil {
+				expanded = make([]interface{}, len(a))
+				copy(expanded, a)
+			}
+			expanded[i] = s
+		}
+	}
+	if expanded == nil {
+		return a
+	}
+	return expanded
+}
+
+// expandStruct renders a struct or map (or a pointer to one) as 'key=value'
+// pairs, in alphabetical order of the keys. Only the top level is expanded,
+// nested values are shown with %v. Values with their own String() or Error()
+// method are left alone, as are empty structs and maps.
+func expandStruct(arg interface{}) (string, bool) {
+	switch arg.(type) {
+	case nil, fmt.Stringer, error:
+		return "", false
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	fields := Fields{}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fields[v.Type().Field(i).Name] = v.Field(i)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			fields[fmt.Sprint(iter.Key())] = iter.Value()
+		}
+	default:
+		return "", false
+	}
+	if len(fields) == 0 {
+		return "", false
+	}
+	return strings.TrimPrefix(textFields(fields), " "), true
 }
 
 // getGID gets the current goroutine ID (algorithm from
@@ -654,60 +3013,169 @@ func getGID() uint64 {
 	return n
 }
 
+// Goroutines, which are inside basicLog and may be calling code of the
+// program, such as a hook or a writer. If that code calls an rlog function,
+// basicLog would be entered again, which may deadlock, for example on the
+// mutex of the log.Logger. Such log calls are dropped. Log calls from other
+// goroutines are not affected.
+var (
+	loggingGoroutines      = make(map[uint64]bool) // goroutine IDs
+	loggingGoroutinesMutex sync.Mutex
+	numLoggingGoroutines   int32
+	recursionReported      int32
+)
+
+// isRecursiveLog returns whether the current goroutine is already inside
+// basicLog, and warns about this once. This is cheap as long as no goroutine
+// is calling code of the program at all. Only then the ID of the goroutine
+// needs to be determined.
+func isRecursiveLog() bool {
+	if atomic.LoadInt32(&numLoggingGoroutines) == 0 {
+		return false
+	}
+	gid := getGID()
+	loggingGoroutinesMutex.Lock()
+	recursive := loggingGoroutines[gid]
+	loggingGoroutinesMutex.Unlock()
+	if !recursive {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&recursionReported, 0, 1) {
+		rlogIssue("Log call from within a hook, formatter or writer. Message dropped.")
+	}
+	atomic.AddUint64(&droppedCount, 1)
+	return true
+}
+
+// guardRecursion registers the current goroutine as being inside basicLog.
+// The returned function removes it again.
+func guardRecursion() func() {
+	gid := getGID()
+	loggingGoroutinesMutex.Lock()
+	loggingGoroutines[gid] = true
+	loggingGoroutinesMutex.Unlock()
+	atomic.AddInt32(&numLoggingGoroutines, 1)
+	return func() {
+		atomic.AddInt32(&numLoggingGoroutines, -1)
+		loggingGoroutinesMutex.Lock()
+		delete(loggingGoroutines, gid)
+		loggingGoroutinesMutex.Unlock()
+	}
+}
+
+// callsProgramCode returns whether basicLog calls any code of the program to
+// write a message, with the current settings. Only then is the more costly
+// recursion guard needed. The caller needs to hold initMutex.
+func callsProgramCode() bool {
+	return len(recordHooks) > 0 || settingFormatter != nil ||
+		settingLineTransform != nil || settingOTelExporter != nil ||
+		!isBuiltinWriter(logWriterStream) || !isBuiltinWriter(logWriterInfo) ||
+		!isBuiltinWriter(logWriterTrace)
+}
+
+// isBuiltinWriter returns whether a log writer only writes to one of the
+// outputs, which rlog sets up itself.
+func isBuiltinWriter(l *log.Logger) bool {
+	if l == nil {
+		return true
+	}
+	switch w := l.Writer(); w {
+	case os.Stdout, os.Stderr, io.Discard:
+		return true
+	default:
+		return syslogWriter != nil && w == syslogWriter
+	}
+}
+
+// clampTraceLevel limits the trace level of a message to the range from 0 to
+// maxTraceLevel. Negative levels would be confused with notATrace.
+func clampTraceLevel(level int) int {
+	if level < 0 {
+		return 0
+	}
+	if level > maxTraceLevel {
+		return maxTraceLevel
+	}
+	return level
+}
+
 // Trace is for low level tracing of activities. It takes an additional 'level'
 // parameter. The RLOG_TRACE_LEVEL variable is used to determine which levels
 // of trace message are output: Every message with a level lower or equal to
 // what is specified in RLOG_TRACE_LEVEL. If RLOG_TRACE_LEVEL is not defined at
 // all then no trace messages are printed.
 func Trace(traceLevel int, a ...interface{}) {
+	if isRecursiveLog() {
+		return
+	}
+	traceLevel = clampTraceLevel(traceLevel)
 	// There are possibly many trace messages. If trace logging isn't enabled
 	// then we want to get out of here as quickly as possible.
 	initMutex.RLock()
 	defer initMutex.RUnlock()
-	if len(traceFilterSpec.filters) > 0 {
-		prefixAddition := fmt.Sprintf("(%d)", traceLevel)
-		basicLog(levelTrace, traceLevel, true, "", prefixAddition, a...)
+	if len(traceFilterSpec.filters) > 0 || settingTraceFilterFunc != nil {
+		prefixAddition := traceLevelPrefix(traceLevel)
+		basicLog(levelTrace, traceLevel, true, nil, "", prefixAddition, a...)
 	}
 }
 
 // Tracef prints trace messages, with formatting.
 func Tracef(traceLevel int, format string, a ...interface{}) {
+	if isRecursiveLog() {
+		return
+	}
+	traceLevel = clampTraceLevel(traceLevel)
 	// There are possibly many trace messages. If trace logging isn't enabled
 	// then we want to get out of here as quickly as possible.
 	initMutex.RLock()
 	defer initMutex.RUnlock()
-	if len(traceFilterSpec.filters) > 0 {
-		prefixAddition := fmt.Sprintf("(%d)", traceLevel)
-		basicLog(levelTrace, traceLevel, true, format, prefixAddition, a...)
+	if len(traceFilterSpec.filters) > 0 || settingTraceFilterFunc != nil {
+		prefixAddition := traceLevelPrefix(traceLevel)
+		basicLog(levelTrace, traceLevel, true, nil, format, prefixAddition, a...)
 	}
 }
 
+// TraceOrDebug is for trace messages, which should at least be logged as debug
+// messages, if tracing isn't enabled for them. If the trace level passes the
+// trace filters, the message is logged as with Trace. Otherwise, it's logged
+// as with Debug.
+func TraceOrDebug(traceLevel int, a ...interface{}) {
+	if isRecursiveLog() {
+		return
+	}
+	traceLevel = clampTraceLevel(traceLevel)
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	prefixAddition := traceLevelPrefix(traceLevel)
+	basicLog(levelTrace, traceLevel, true, &logExtras{debugFallback: true}, "", prefixAddition, a...)
+}
+
 // Debug prints a message if RLOG_LEVEL is set to DEBUG.
 func Debug(a ...interface{}) {
-	basicLog(levelDebug, notATrace, false, "", "", a...)
+	basicLog(levelDebug, notATrace, false, nil, "", "", a...)
 }
 
 // Debugf prints a message if RLOG_LEVEL is set to DEBUG, with formatting.
 func Debugf(format string, a ...interface{}) {
-	basicLog(levelDebug, notATrace, false, format, "", a...)
+	basicLog(levelDebug, notATrace, false, nil, format, "", a...)
 }
 
 // Info prints a message if RLOG_LEVEL is set to INFO or lower.
 func Info(a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, "", "", a...)
+	basicLog(levelInfo, notATrace, false, nil, "", "", a...)
 }
 
 // Infof prints a message if RLOG_LEVEL is set to INFO or lower, with
 // formatting.
 func Infof(format string, a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, format, "", a...)
+	basicLog(levelInfo, notATrace, false, nil, format, "", a...)
 }
 
 // Println prints a message if RLOG_LEVEL is set to INFO or lower.
 // Println shouldn't be used except for backward compatibility
 // with standard log package, directly using Info is preferred way.
 func Println(a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, "", "", a...)
+	basicLog(levelInfo, notATrace, false, nil, "", "", a...)
 }
 
 // Printf prints a message if RLOG_LEVEL is set to INFO or lower, with
@@ -715,38 +3183,268 @@ func Println(a ...interface{}) {
 // Printf shouldn't be used except for backward compatibility
 // with standard log package, directly using Infof is preferred way.
 func Printf(format string, a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, format, "", a...)
+	basicLog(levelInfo, notATrace, false, nil, format, "", a...)
 }
 
 // Warn prints a message if RLOG_LEVEL is set to WARN or lower.
 func Warn(a ...interface{}) {
-	basicLog(levelWarn, notATrace, false, "", "", a...)
+	basicLog(levelWarn, notATrace, false, nil, "", "", a...)
 }
 
 // Warnf prints a message if RLOG_LEVEL is set to WARN or lower, with
 // formatting.
 func Warnf(format string, a ...interface{}) {
-	basicLog(levelWarn, notATrace, false, format, "", a...)
+	basicLog(levelWarn, notATrace, false, nil, format, "", a...)
 }
 
 // Error prints a message if RLOG_LEVEL is set to ERROR or lower.
 func Error(a ...interface{}) {
-	basicLog(levelErr, notATrace, false, "", "", a...)
+	basicLog(levelErr, notATrace, false, nil, "", "", a...)
 }
 
 // Errorf prints a message if RLOG_LEVEL is set to ERROR or lower, with
 // formatting.
 func Errorf(format string, a ...interface{}) {
-	basicLog(levelErr, notATrace, false, format, "", a...)
+	basicLog(levelErr, notATrace, false, nil, format, "", a...)
 }
 
 // Critical prints a message if RLOG_LEVEL is set to CRITICAL or lower.
 func Critical(a ...interface{}) {
-	basicLog(levelCrit, notATrace, false, "", "", a...)
+	basicLog(levelCrit, notATrace, false, nil, "", "", a...)
 }
 
 // Criticalf prints a message if RLOG_LEVEL is set to CRITICAL or lower, with
 // formatting.
 func Criticalf(format string, a ...interface{}) {
-	basicLog(levelCrit, notATrace, false, format, "", a...)
+	basicLog(levelCrit, notATrace, false, nil, format, "", a...)
+}
+
+// Fatal logs a message at the CRITICAL level, writes out any buffered output
+// and then exits the program. The exit code is 1, unless a different one was
+// set via SetFatalExitCode(). If CRITICAL is above the level set via
+// SetMaxEmittedLevel(), the program isn't exited.
+func Fatal(a ...interface{}) {
+	extras := &logExtras{}
+	basicLog(levelCrit, notATrace, false, extras, "", "", a...)
+	exitFatal(extras, fatalExitCode())
+}
+
+// Fatalf is like Fatal, with formatting.
+func Fatalf(format string, a ...interface{}) {
+	extras := &logExtras{}
+	basicLog(levelCrit, notATrace, false, extras, format, "", a...)
+	exitFatal(extras, fatalExitCode())
+}
+
+// FatalCode is like Fatal, but exits the program with the given code.
+func FatalCode(code int, a ...interface{}) {
+	extras := &logExtras{}
+	basicLog(levelCrit, notATrace, false, extras, "", "", a...)
+	exitFatal(extras, code)
+}
+
+// osExit is used to exit the program after a fatal message. It is only
+// replaced in tests.
+var osExit = os.Exit
+
+// settingFatalExitCode is the exit code set via SetFatalExitCode().
+var settingFatalExitCode = 1
+
+// SetFatalExitCode sets the code, which Fatal and Fatalf use to exit the
+// program. The default is 1, as with log.Fatal.
+func SetFatalExitCode(code int) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	settingFatalExitCode = code
+}
+
+// fatalExitCode returns the exit code for Fatal and Fatalf.
+func fatalExitCode() int {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	return settingFatalExitCode
+}
+
+// exitFatal writes out any buffered output and exits the program, unless the
+// message of the fatal log function was capped by the maximum level.
+func exitFatal(extras *logExtras, code int) {
+	if extras.capped {
+		return
+	}
+	Flush()
+	osExit(code)
+}
+
+// LogAt logs a message at the given level ("DEBUG", "INFO", "WARN", "ERROR" or
+// "CRITICAL"), but uses the supplied time for the time stamp, rather than the
+// current time. This is useful when replaying or importing events that
+// happened earlier.
+func LogAt(t time.Time, level string, a ...interface{}) {
+	logLevel, ok := levelNumbers[strings.ToUpper(level)]
+	if !ok || logLevel == levelTrace || logLevel == levelNone {
+		rlogIssue("Illegal log level '%s'.", level)
+		return
+	}
+	basicLog(logLevel, notATrace, false, &logExtras{time: t}, "", "", a...)
+}
+
+// Tracet prints trace messages, with a template. See Infot for details.
+func Tracet(traceLevel int, template string, fields Fields) {
+	if isRecursiveLog() {
+		return
+	}
+	traceLevel = clampTraceLevel(traceLevel)
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	if len(traceFilterSpec.filters) > 0 || settingTraceFilterFunc != nil {
+		prefixAddition := traceLevelPrefix(traceLevel)
+		basicLog(levelTrace, traceLevel, true, &logExtras{fields: fields}, "", prefixAddition,
+			renderTemplate(template, fields))
+	}
+}
+
+// Debugt prints a message if RLOG_LEVEL is set to DEBUG, with a template. See
+// Infot for details.
+func Debugt(template string, fields Fields) {
+	basicLog(levelDebug, notATrace, false, &logExtras{fields: fields}, "", "",
+		renderTemplate(template, fields))
+}
+
+// Infot prints a message if RLOG_LEVEL is set to INFO or lower, with a
+// template. Placeholders in the template, such as {user}, are replaced by the
+// value of the field with that name:
+//
+//	rlog.Infot("{user} logged in", rlog.Fields{"user": name})
+//
+// Placeholders without a matching field are left as they are. The fields are
+// also logged as fields, so that they are available separately in structured
+// output.
+func Infot(template string, fields Fields) {
+	basicLog(levelInfo, notATrace, false, &logExtras{fields: fields}, "", "",
+		renderTemplate(template, fields))
+}
+
+// Warnt prints a message if RLOG_LEVEL is set to WARN or lower, with a
+// template. See Infot for details.
+func Warnt(template string, fields Fields) {
+	basicLog(levelWarn, notATrace, false, &logExtras{fields: fields}, "", "",
+		renderTemplate(template, fields))
+}
+
+// Errort prints a message if RLOG_LEVEL is set to ERROR or lower, with a
+// template. See Infot for details.
+func Errort(template string, fields Fields) {
+	basicLog(levelErr, notATrace, false, &logExtras{fields: fields}, "", "",
+		renderTemplate(template, fields))
+}
+
+// Criticalt prints a message if RLOG_LEVEL is set to CRITICAL or lower, with a
+// template. See Infot for details.
+func Criticalt(template string, fields Fields) {
+	basicLog(levelCrit, notATrace, false, &logExtras{fields: fields}, "", "",
+		renderTemplate(template, fields))
+}
+
+// renderTemplate replaces the {name} placeholders in a template by the values
+// of the fields with that name. Placeholders without a matching field are
+// left as they are.
+func renderTemplate(template string, fields Fields) string {
+	var buf bytes.Buffer
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		buf.WriteString(template[:start])
+		if value, ok := fields[template[start+1:end]]; ok {
+			fmt.Fprint(&buf, value)
+		} else {
+			buf.WriteString(template[start : end+1])
+		}
+		template = template[end+1:]
+	}
+	buf.WriteString(template)
+	return buf.String()
+}
+
+// LogLevel logs a message at the given level. This is useful if the level is
+// only known at runtime. Unlike LogAt, it doesn't need to look up the level by
+// name. A level, which isn't known, is filtered like CRITICAL if it is more
+// severe, or like DEBUG if it is less severe, and shown with the name set via
+// SetUnknownLevelName().
+func LogLevel(l Level, a ...interface{}) {
+	if l == Level(levelNone) || l == Level(levelTrace) {
+		rlogIssue("Illegal log level %d.", int(l))
+		return
+	}
+	var extras *logExtras
+	if l < CriticalLevel || l > Level(levelTrace) {
+		extras = &logExtras{unknownLevel: true}
+		if l < CriticalLevel {
+			l = CriticalLevel
+		} else {
+			l = DebugLevel
+		}
+	}
+	basicLog(int(l), notATrace, false, extras, "", "", a...)
+}
+
+// Timer starts a timer and returns a function, which logs the given message at
+// DEBUG level, together with the time elapsed since Timer was called. The
+// elapsed time is logged as field 'elapsed'. Timer is meant to be used with
+// defer:
+//
+//	defer rlog.Timer("handleRequest")()
+func Timer(msg string) func() {
+	start := currentTime()
+	return func() {
+		extras := &logExtras{fields: Fields{"elapsed": currentTime().Sub(start)}}
+		basicLog(levelDebug, notATrace, false, extras, "", "", msg)
+	}
+}
+
+// TraceCtx is a timer for a traced region of code, as returned by TraceScope.
+// It's not meant to be shared between goroutines.
+type TraceCtx struct {
+	level int       // trace level of the steps
+	start time.Time // time at which the scope was started
+	last  time.Time // time of the previous step
+}
+
+// TraceScope starts a timer for a traced region of code. The steps within the
+// region are logged with Step, together with the time elapsed since the start
+// and since the previous step. This allows quick profiling of an operation:
+//
+//	scope := rlog.TraceScope(2)
+//	loadConfig()
+//	scope.Step("Config loaded")
+//	connect()
+//	scope.Step("Connected")
+func TraceScope(level int) *TraceCtx {
+	now := currentTime()
+	return &TraceCtx{level: clampTraceLevel(level), start: now, last: now}
+}
+
+// Step logs a trace message at the level of the scope, like Trace. The time
+// elapsed since the start of the scope is logged as field 'elapsed', the time
+// since the previous step as field 'delta'. If trace logging isn't enabled,
+// Step returns right away.
+func (c *TraceCtx) Step(msg string) {
+	if isRecursiveLog() {
+		return
+	}
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	if len(traceFilterSpec.filters) == 0 && settingTraceFilterFunc == nil {
+		return
+	}
+	now := clock()
+	extras := &logExtras{fields: Fields{"elapsed": now.Sub(c.start), "delta": now.Sub(c.last)}}
+	c.last = now
+	basicLog(levelTrace, c.level, true, extras, "", traceLevelPrefix(c.level), msg)
 }
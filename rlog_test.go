@@ -17,11 +17,18 @@ package rlog
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"os"
 	"path"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -123,6 +130,14 @@ func fileMatch(t *testing.T, checkLines []string, timeLayout string) {
 	}
 }
 
+// skipWithoutCallerLookup skips tests, which rely on caller information, if
+// rlog was built with the rlog_nocaller tag.
+func skipWithoutCallerLookup(t *testing.T) {
+	if !callerLookupEnabled {
+		t.Skip("rlog was built without caller lookups")
+	}
+}
+
 // ---------- Tests -----------
 
 // TestLogLevels performs some basic tests for each known log level.
@@ -234,8 +249,9 @@ func TestLogTimestamp(t *testing.T) {
 		//"RFC3339Nano": time.RFC3339Nano,  // Not included in the tests, since
 		// output length can vary depending on whether there are trailing zeros.
 		// Not worth the trouble.
-		"Kitchen": time.Kitchen,
-		"":        time.RFC3339, // If nothing specified, default is RFC3339
+		"Kitchen":             time.Kitchen,
+		"TimeOnly":            "15:04:05.000",
+		"":                    time.RFC3339,          // If nothing specified, default is RFC3339
 		"2006/01/02 15:04:05": "2006/01/02 15:04:05", // custom format
 	}
 
@@ -258,6 +274,7 @@ func TestLogTimestamp(t *testing.T) {
 // within the test is pretty much exactly the code that should be at work
 // within rlog.
 func TestLogCallerInfo(t *testing.T) {
+	skipWithoutCallerLookup(t)
 	conf := setup()
 	defer cleanup()
 
@@ -292,6 +309,7 @@ func TestLogCallerInfo(t *testing.T) {
 // filter for a non-existent module, so that trace messages should not be
 // displayed.
 func TestLogLevelsFiltered(t *testing.T) {
+	skipWithoutCallerLookup(t)
 	conf := setup()
 	defer cleanup()
 
@@ -328,6 +346,22 @@ func writeLogfile(lines []string) string {
 	return confFile
 }
 
+// countOpenFiles returns how often the given file is open in this process.
+// The test is skipped, if this can't be determined on this system.
+func countOpenFiles(t *testing.T, name string) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("Open files can't be determined:", err)
+	}
+	n := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink("/proc/self/fd/" + fd.Name()); err == nil && target == name {
+			n++
+		}
+	}
+	return n
+}
+
 // checkLogFilter simplifies the checking of correct log levels in the tests.
 func checkLogFilter(t *testing.T, shouldPattern string, shouldLevel int) {
 	f := logFilterSpec.filters[0]
@@ -383,14 +417,90 @@ func TestConfFile(t *testing.T) {
 	checkLogFilter(t, "foo.go", levelDebug)
 }
 
+// TestConfFileFlags checks that flags from the environment can be switched on
+// and off by the config file, and that the '!' override can be disabled.
+func TestConfFileFlags(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	tests := []struct {
+		env      string
+		override string
+		confLine string
+		result   bool
+	}{
+		{"", "", "RLOG_CALLER_INFO=yes", true},
+		{"1", "", "RLOG_CALLER_INFO=off", true},
+		{"1", "", "!RLOG_CALLER_INFO=false", false},
+		{"off", "", "RLOG_CALLER_INFO=on", false},
+		{"off", "", "!RLOG_CALLER_INFO=on", true},
+		{"maybe", "", "RLOG_CALLER_INFO=on", true},
+		{"1", "yes", "!RLOG_CALLER_INFO=false", false},
+		{"1", "no", "!RLOG_CALLER_INFO=false", true},
+		{"", "no", "!RLOG_CALLER_INFO=on", true},
+	}
+	for _, test := range tests {
+		conf.showCallerInfo = test.env
+		conf.allowOverride = test.override
+		conf.confFile = writeLogfile([]string{test.confLine})
+		initialize(conf, true)
+		os.Remove(conf.confFile)
+		if settingShowCallerInfo != test.result {
+			t.Fatalf("Incorrect caller info setting for env '%s', override '%s' and '%s'",
+				test.env, test.override, test.confLine)
+		}
+	}
+}
+
+// TestConfFileList checks that several config files are read in order, with
+// later files replacing settings of earlier ones, and that missing files are
+// skipped.
+func TestConfFileList(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	base := writeLogfile([]string{"RLOG_LOG_LEVEL=WARN", "RLOG_SHOW_SEQ=yes"})
+	defer os.Remove(base)
+	override := writeLogfile([]string{"RLOG_LOG_LEVEL=DEBUG"})
+	defer os.Remove(override)
+	conf.confFile = base + ", /nonexistent/rlog.conf:" + override
+	initialize(conf, true)
+	checkLogFilter(t, "", levelDebug)
+	if !settingShowSeq {
+		t.Fatal("Setting of the first config file wasn't applied")
+	}
+
+	// The environment variables still take precedence.
+	conf.logLevel = "ERROR"
+	initialize(conf, true)
+	checkLogFilter(t, "", levelErr)
+
+	// Within a file, the first occurrence of a setting is used, unless a
+	// later one has priority, which a plain line doesn't take away again.
+	os.Remove(override)
+	override = writeLogfile([]string{"RLOG_LOG_LEVEL=INFO", "RLOG_LOG_LEVEL=DEBUG",
+		"!RLOG_SHOW_SEQ=no", "RLOG_SHOW_SEQ=yes"})
+	conf.confFile = base + "," + override
+	conf.logLevel = ""
+	conf.showSeq = "yes"
+	initialize(conf, true)
+	checkLogFilter(t, "", levelInfo)
+	if settingShowSeq {
+		t.Fatal("Setting with priority was replaced")
+	}
+}
+
 // TestRaceConditions stress tests thread safety of rlog. Useful when running
 // with the race detector flag (--race).
 func TestRaceConditions(t *testing.T) {
 	conf := setup()
 	defer cleanup()
 
+	var wg sync.WaitGroup
 	for i := 0; i < 1000; i++ {
+		wg.Add(1)
 		go func(conf rlogConfig, i int) {
+			defer wg.Done()
 			for j := 0; j < 100; j++ {
 				// Change behaviour and config around a little
 				if j%2 == 0 {
@@ -408,4 +518,1887 @@ func TestRaceConditions(t *testing.T) {
 			}
 		}(conf, i)
 	}
+	wg.Wait()
+}
+
+// TestConcurrentReconfiguration changes the configuration via the setters and
+// by re-reading the config file, while messages are logged. Useful when
+// running with the race detector flag (--race).
+func TestConcurrentReconfiguration(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.confFile = writeLogfile([]string{"RLOG_LOG_LEVEL=DEBUG"})
+	defer os.Remove(conf.confFile)
+	initialize(conf, true)
+	// Re-read the config file for every message.
+	initMutex.Lock()
+	oldCheckInterval := settingCheckInterval
+	settingCheckInterval = time.Nanosecond
+	initMutex.Unlock()
+	defer func() {
+		settingCheckInterval = oldCheckInterval
+		initialize(conf, true)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				switch (i + j) % 4 {
+				case 0:
+					SetShowTime(j%2 == 0)
+				case 1:
+					SetDefaultLogLevel("WARN")
+				case 2:
+					SetConfFile(conf.confFile)
+				case 3:
+					SetOutput(ioutil.Discard)
+				}
+				Info("Test Info")
+				Trace(1, "Some trace")
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestEnableTraceForLoggedFiles checks that trace filters are added for the
+// files with a raised log level, and that explicit trace filters still win.
+func TestEnableTraceForLoggedFiles(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "WARN,server.go=DEBUG,client.go=INFO,noisy.go=ERROR"
+	conf.traceLevel = "client.go=1,2"
+	initialize(conf, true)
+
+	EnableTraceForLoggedFiles(3)
+	if fmt.Sprint(traceFilterSpec.filters) != "[{client.go 1} {server.go 3} {client.go 3} { 2}]" {
+		t.Fatal("Incorrect trace filters: ", traceFilterSpec.filters)
+	}
+	if !traceFilterSpec.matchfilters("foo/server.go", "foo.Func", 3) ||
+		traceFilterSpec.matchfilters("foo/client.go", "foo.Func", 2) ||
+		traceFilterSpec.matchfilters("foo/noisy.go", "foo.Func", 3) {
+		t.Fatal("Incorrect filter result")
+	}
+
+	// The trace filters follow changes of the log filters, for example when
+	// the config file is re-read.
+	conf.logLevel = "DEBUG,server.go=INFO"
+	initialize(conf, false)
+	if fmt.Sprint(traceFilterSpec.filters) != "[{client.go 1} { 2}]" {
+		t.Fatal("Incorrect trace filters: ", traceFilterSpec.filters)
+	}
+
+	conf.logLevel = "WARN,server.go=DEBUG"
+	initialize(conf, false)
+	EnableTraceForLoggedFiles(-1)
+	if fmt.Sprint(traceFilterSpec.filters) != "[{client.go 1} { 2}]" {
+		t.Fatal("Incorrect trace filters: ", traceFilterSpec.filters)
+	}
+}
+
+// TestEnableDisableTrace checks that the global trace level can be changed at
+// runtime, while per-file trace filters are left alone.
+func TestEnableDisableTrace(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "foobar.go=5"
+	initialize(conf, true)
+
+	EnableTrace(2)
+	if len(traceFilterSpec.filters) != 2 {
+		t.Fatal("Incorrect trace filters: ", traceFilterSpec.filters)
+	}
+	Trace(1, "Trace 1")
+	Trace(2, "Trace 2")
+	Trace(3, "Trace 3")
+
+	// Only the global trace level should be gone after this, the named filter
+	// for the other file remains.
+	DisableTrace()
+	if len(traceFilterSpec.filters) != 1 || traceFilterSpec.filters[0].Pattern != "foobar.go" {
+		t.Fatal("Incorrect trace filters: ", traceFilterSpec.filters)
+	}
+	Trace(1, "Trace 1")
+
+	// Without any named filters, the filter chain needs to be empty, so that
+	// the fast exit in Trace() works.
+	conf.traceLevel = ""
+	initialize(conf, true)
+	EnableTrace(2)
+	DisableTrace()
+	if len(traceFilterSpec.filters) != 0 {
+		t.Fatal("Incorrect trace filters: ", traceFilterSpec.filters)
+	}
+
+	checkLines := []string{
+		"TRACE(1) : Trace 1",
+		"TRACE(2) : Trace 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetShowTime checks that date/time stamps can be switched off and on at
+// runtime and that the configured time format is restored afterwards.
+func TestSetShowTime(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logNoTime = "false"
+	conf.logTimeFormat = "Kitchen"
+	initialize(conf, true)
+
+	SetShowTime(false)
+	if settingDateTimeFormat != "" {
+		t.Fatalf("Time format should be empty, but is '%s'", settingDateTimeFormat)
+	}
+	Info("Test Info")
+
+	SetShowTime(true)
+	if settingDateTimeFormat != time.Kitchen+" " {
+		t.Fatalf("Time format should be '%s', but is '%s'", time.Kitchen, settingDateTimeFormat)
+	}
+
+	checkLines := []string{
+		"INFO     : Test Info",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestLogLevelsFilteredByFunc checks that filters can be specified for
+// individual functions.
+func TestLogLevelsFilteredByFunc(t *testing.T) {
+	skipWithoutCallerLookup(t)
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "func:TestLogLevelsFilteredBy*=DEBUG,WARN"
+	conf.traceLevel = "func:someOtherFunc=5"
+	initialize(conf, true)
+
+	Debug("Test Debug")
+	Trace(1, "Trace 1")
+
+	checkLines := []string{
+		"DEBUG    : Test Debug",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestLogLevelsFilteredByPackage checks that filters can be specified for
+// whole packages.
+func TestLogLevelsFilteredByPackage(t *testing.T) {
+	skipWithoutCallerLookup(t)
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "pkg:rlog=DEBUG,WARN"
+	conf.traceLevel = "pkg:github.com/romana/rlo*=2,pkg:other=5"
+	initialize(conf, true)
+
+	Debug("Test Debug")
+	Trace(2, "Trace 2")
+	Trace(3, "Trace 3")
+
+	checkLines := []string{
+		"DEBUG    : Test Debug",
+		"TRACE(2) : Trace 2",
+	}
+	fileMatch(t, checkLines, "")
+
+	tests := []struct{ funcName, pkg string }{
+		{"github.com/foo/bar.(*Server).Handle", "github.com/foo/bar"},
+		{"github.com/foo/bar.Run.func1", "github.com/foo/bar"},
+		{"main.main", "main"},
+		{"gopkg.in/yaml%2ev2.Marshal", "gopkg.in/yaml.v2"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if pkg := packagePath(test.funcName); pkg != test.pkg {
+			t.Fatalf("Expected package '%s' for '%s', but got '%s'", test.pkg, test.funcName, pkg)
+		}
+	}
+}
+
+// TestLogHostname checks that the configured host name is logged, if
+// requested.
+func TestLogHostname(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.showHostname = "yes"
+	conf.hostname = "testhost"
+	initialize(conf, true)
+	Info("Test Info")
+
+	// Without a configured host name, the kernel's host name is used.
+	conf.hostname = ""
+	initialize(conf, true)
+	Info("Test Info")
+
+	hostname, _ := os.Hostname()
+	checkLines := []string{
+		"[testhost] INFO     : Test Info",
+		"[" + hostname + "] INFO     : Test Info",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestLogAt checks that a message can be logged with a time stamp supplied by
+// the caller.
+func TestLogAt(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logNoTime = "false"
+	conf.logTimeFormat = "2006/01/02 15:04:05"
+	initialize(conf, true)
+
+	LogAt(time.Date(2016, 12, 5, 12, 3, 41, 0, time.Local), "warn", "Test Warning")
+	LogAt(time.Now(), "TRACE", "Illegal level")
+
+	checkLines := []string{
+		"2016/12/05 12:03:41 WARN     : Test Warning",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetTimeFormat checks that the date/time format can be changed at runtime
+// and that invalid layouts are rejected.
+func TestSetTimeFormat(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	initialize(conf, true)
+
+	if err := SetTimeFormat("no time in here"); err == nil {
+		t.Fatal("Invalid time format should have been rejected")
+	}
+	if err := SetTimeFormat("2006/01/02 15:04"); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info")
+
+	checkLines := []string{
+		"INFO     : Test Info",
+	}
+	fileMatch(t, checkLines, "2006/01/02 15:04")
+
+	if err := SetTimeFormat(""); err != nil || settingDateTimeFormat != "" {
+		t.Fatalf("Time stamps should be disabled, but format is '%s'", settingDateTimeFormat)
+	}
+}
+
+// brokenWriter is an io.Writer that fails on demand.
+type brokenWriter struct {
+	bytes.Buffer
+	broken bool
+}
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	if w.broken {
+		return 0, errors.New("broken writer")
+	}
+	return w.Buffer.Write(p)
+}
+
+// TestSetFailover checks that output only goes to the fallback writer while
+// the primary writer fails.
+func TestSetFailover(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	initialize(conf, true)
+
+	primary := &brokenWriter{}
+	fallback := &bytes.Buffer{}
+	SetFailover(primary, fallback)
+	defer SetOutput(os.Stderr)
+
+	Info("Line 1")
+	primary.broken = true
+	Info("Line 2")
+	primary.broken = false
+	Info("Line 3")
+
+	if primary.String() != "INFO     : Line 1\nINFO     : Line 3\n" {
+		t.Fatalf("Incorrect primary output: %q", primary.String())
+	}
+	if fallback.String() != "INFO     : Line 2\n" {
+		t.Fatalf("Incorrect fallback output: %q", fallback.String())
+	}
+}
+
+// TestSetMaxEmittedLevel checks that messages more severe than the cap are
+// dropped or downgraded.
+func TestSetMaxEmittedLevel(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "1"
+	initialize(conf, true)
+	defer SetMaxEmittedLevel("", false)
+
+	if err := SetMaxEmittedLevel("TRACE", false); err == nil {
+		t.Fatal("Illegal level should have been rejected")
+	}
+
+	SetMaxEmittedLevel("WARN", false)
+	Info("Test Info")
+	Warn("Test Warning")
+	Error("Test Error")
+	Trace(1, "Trace 1")
+
+	// Fatal doesn't exit the program, if its message is capped.
+	defer func() { osExit = os.Exit }()
+	exits := 0
+	osExit = func(code int) { exits++ }
+	Fatal("Test Fatal")
+
+	SetMaxEmittedLevel("warn", true)
+	Critical("Test Critical")
+	Fatalf("Test %s", "Fatal 2")
+	FatalCode(3, "Test Fatal 3")
+	if exits != 0 {
+		t.Fatalf("Program was exited %d times", exits)
+	}
+	SetMaxEmittedLevel("", false)
+	Fatal("Test Fatal 4")
+	if exits != 1 {
+		t.Fatal("Program wasn't exited without the cap")
+	}
+
+	checkLines := []string{
+		"INFO     : Test Info",
+		"WARN     : Test Warning",
+		"TRACE(1) : Trace 1",
+		"WARN     : Test Critical",
+		"WARN     : Test Fatal 2",
+		"WARN     : Test Fatal 3",
+		"CRITICAL : Test Fatal 4",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestParseSpec checks that filter specs can be parsed and that malformed
+// specs are reported as errors.
+func TestParseSpec(t *testing.T) {
+	filters, err := ParseLogSpec("client.go=error,WARN,func:Handle*=DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shouldFilters := []Filter{
+		{"client.go", levelErr},
+		{"func:Handle*", levelDebug},
+		{"", levelWarn},
+	}
+	if fmt.Sprint(filters) != fmt.Sprint(shouldFilters) {
+		t.Fatalf("Incorrect filters %v. Should be: %v", filters, shouldFilters)
+	}
+
+	filters, err = ParseTraceSpec("client.go=3")
+	if err != nil || len(filters) != 1 || filters[0] != (Filter{"client.go", 3}) {
+		t.Fatalf("Incorrect trace filters %v (%v)", filters, err)
+	}
+
+	if s := fmt.Sprint(filters); s != "[client.go=3]" {
+		t.Fatalf("Incorrect string for trace filters: %s", s)
+	}
+
+	for _, spec := range []string{"FOO", "client.go=", "a=b=c", "TRACE"} {
+		if _, err := ParseLogSpec(spec); err == nil {
+			t.Fatalf("Log spec '%s' should have been rejected", spec)
+		}
+	}
+	if _, err := ParseTraceSpec("client.go=DEBUG"); err == nil {
+		t.Fatal("Non-numeric trace level should have been rejected")
+	}
+}
+
+// TestSetVersion checks that the application version is logged, if set.
+func TestSetVersion(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	initialize(conf, true)
+
+	SetVersion("1.2.3")
+	Info("Test Info")
+	SetVersion("")
+	Info("Test Info")
+
+	checkLines := []string{
+		"[1.2.3] INFO     : Test Info",
+		"INFO     : Test Info",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestDiscard checks that discarded output is detected.
+func TestDiscard(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	initialize(conf, true)
+
+	if IsDiscarding() {
+		t.Fatal("Output to the logfile should not be discarding")
+	}
+	Discard()
+	if !IsDiscarding() {
+		t.Fatal("Output should be discarding after Discard()")
+	}
+	SetConfFile("")
+	if !IsDiscarding() {
+		t.Fatal("Output should still be discarding after reading the config")
+	}
+	SetOutput(io.Discard)
+	if !IsDiscarding() {
+		t.Fatal("Output to io.Discard should be discarding")
+	}
+	SetOutput(os.Stderr)
+	if IsDiscarding() {
+		t.Fatal("Output to stderr should not be discarding")
+	}
+}
+
+// TestDefaultLogLevel checks that the default log level is only used if no
+// global log level was specified.
+func TestDefaultLogLevel(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.defaultLogLevel = "WARN"
+	initialize(conf, true)
+	checkLogFilter(t, "", levelWarn)
+
+	if err := SetDefaultLogLevel("foo"); err == nil {
+		t.Fatal("Illegal log level should have been rejected")
+	}
+	SetDefaultLogLevel("error")
+	checkLogFilter(t, "", levelErr)
+
+	conf.logLevel = "DEBUG"
+	initialize(conf, true)
+	checkLogFilter(t, "", levelDebug)
+}
+
+// TestConfFileIsDirectory checks that a config file path pointing to a
+// directory is ignored.
+func TestConfFileIsDirectory(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.confFile = os.TempDir()
+	initialize(conf, true)
+	initialize(conf, true)
+	checkLogFilter(t, "", levelInfo)
+	if confFileIssueReported != conf.confFile {
+		t.Fatal("Unusable config file was not reported")
+	}
+}
+
+// TestSetLevelPrefix checks that prefixes are shown in front of the level.
+func TestSetLevelPrefix(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	initialize(conf, true)
+
+	SetLevelPrefix("warn", "!")
+	SetLevelPrefix("CRITICAL", "@ops")
+	defer SetLevelPrefix("WARN", "")
+	defer SetLevelPrefix("CRITICAL", "")
+
+	Info("Test Info")
+	Warn("Test Warning")
+	Critical("Test Critical")
+
+	checkLines := []string{
+		"INFO     : Test Info",
+		"! WARN   : Test Warning",
+		"@ops CRITICAL: Test Critical",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestTimer checks that the elapsed time is logged by a timer.
+func TestTimer(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	initialize(conf, true)
+
+	var elapsed interface{}
+	defer AddRecordHook(func(r Record) { elapsed = r.Fields["elapsed"] })()
+
+	start := time.Now()
+	stop := Timer("Test Timer")
+	stop()
+
+	if d, ok := elapsed.(time.Duration); !ok || d < 0 || d > time.Since(start) {
+		t.Fatalf("Incorrect elapsed time: %v", elapsed)
+	}
+	checkLines := []string{
+		fmt.Sprintf("DEBUG    : Test Timer elapsed=%v", elapsed),
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestTraceScope checks that the steps of a trace scope are logged with the
+// time since the start and since the previous step.
+func TestTraceScope(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "2"
+	initialize(conf, true)
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	scope := TraceScope(2)
+	now = now.Add(time.Second)
+	scope.Step("Step 1")
+	now = now.Add(2 * time.Second)
+	scope.Step("Step 2")
+	TraceScope(3).Step("Not traced")
+
+	checkLines := []string{
+		"TRACE(2) : Step 1 delta=1s elapsed=1s",
+		"TRACE(2) : Step 2 delta=2s elapsed=3s",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetTraceLevelFormat checks that the trace level can be shown in a custom
+// format or not at all.
+func TestSetTraceLevelFormat(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "3"
+	initialize(conf, true)
+
+	Trace(1, "Trace 1")
+	SetTraceLevelFormat(func(l int) string { return fmt.Sprintf(".%d", l) })
+	Trace(2, "Trace 2")
+	Tracef(3, "Trace %d", 3)
+	SetTraceLevelFormat(nil)
+	Trace(3, "Trace 3")
+	SetTraceShowLevel(false)
+	Trace(3, "Trace 3 without level")
+	Trace(4, "Trace 4")
+	SetTraceShowLevel(true)
+
+	checkLines := []string{
+		"TRACE(1) : Trace 1",
+		"TRACE.2  : Trace 2",
+		"TRACE.3  : Trace 3",
+		"TRACE(3) : Trace 3",
+		"TRACE    : Trace 3 without level",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestActiveFilters checks that the filters currently in effect are returned.
+func TestActiveFilters(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "client.go=DEBUG,WARN"
+	conf.traceLevel = "server.go=2"
+	initialize(conf, true)
+
+	if s := fmt.Sprint(LogFilters()); s != "[client.go=5 3]" {
+		t.Fatalf("Incorrect log filters: %s", s)
+	}
+	EnableTrace(1)
+	defer DisableTrace()
+	if s := fmt.Sprint(TraceFilters()); s != "[server.go=2 1]" {
+		t.Fatalf("Incorrect trace filters: %s", s)
+	}
+}
+
+// TestReopenLogFile checks that output goes to a new logfile after the old one
+// was renamed and the logfile was reopened.
+func TestReopenLogFile(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	Info("Test Info 1")
+	rotated := logfile + ".1"
+	defer os.Remove(rotated)
+	if err := os.Rename(logfile, rotated); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info 2")
+	if err := ReopenLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info 3")
+	Flush()
+
+	checkLines := []string{
+		"INFO     : Test Info 3",
+	}
+	fileMatch(t, checkLines, "")
+	content, err := ioutil.ReadFile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "INFO     : Test Info 1\nINFO     : Test Info 2\n" {
+		t.Fatalf("Incorrect content of rotated logfile: %q", content)
+	}
+}
+
+// TestLogFileWriteError checks that the logfile is opened again after a write
+// error and that file output is given up if that doesn't help.
+func TestLogFileWriteError(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	w := logWriterFile.Writer().(*logFileWriter)
+
+	Info("Test Info 1")
+	w.file.Close()
+	Info("Test Info 2")
+	if w.failed || LastError() != nil {
+		t.Fatalf("Logfile should have been reopened: %v", LastError())
+	}
+	checkLines := []string{
+		"INFO     : Test Info 1",
+		"INFO     : Test Info 2",
+	}
+	fileMatch(t, checkLines, "")
+
+	w.file.Close()
+	w.name = "/nonexistent/rlog-test.log"
+	Info("Test Info 3")
+	if !w.failed || LastError() == nil {
+		t.Fatal("Logfile should have been given up")
+	}
+	setLastError(nil)
+}
+
+// TestReopenLogFileAfterError checks that buffered output is written again
+// after the logfile was given up and then reopened.
+func TestReopenLogFileAfterError(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer setLastError(nil)
+
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	w := currentLogFileWriter()
+
+	Info("Test Info 1")
+	Flush()
+	w.file.Close()
+	w.name = "/nonexistent/rlog-test.log"
+	Info("Test Info 2")
+	if Flush() == nil || !w.failed {
+		t.Fatal("Logfile should have been given up")
+	}
+	w.name = logfile
+	if err := ReopenLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info 3")
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLines := []string{
+		"INFO     : Test Info 1",
+		"INFO     : Test Info 3",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestReconfigure checks that a new configuration is applied as a whole, and
+// that an invalid configuration is rejected without changing anything.
+func TestReconfigure(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	defer SetFormatter(nil)
+
+	config := Config{
+		LogLevel:   "WARN",
+		TraceLevel: "2",
+		LogFile:    logfile,
+		LogStream:  "none",
+		LogNoTime:  "yes",
+		TimeFormat: "Kitchen",
+	}
+	if err := Reconfigure(config); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info")
+	Warn("Test Warning")
+	Trace(2, "Trace 2")
+
+	bad := config
+	bad.LogLevel = "LOUD"
+	bad.CallerInfo = "maybe"
+	bad.LogFile = "/nonexistent/rlog-test.log"
+	bad.Formatter = GELFFormatter{}
+	err := Reconfigure(bad)
+	if err == nil {
+		t.Fatal("Invalid config should have been rejected")
+	}
+	for _, s := range []string{"LOUD", "maybe", "/nonexistent/rlog-test.log"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("Error '%s' doesn't mention '%s'", err, s)
+		}
+	}
+	Warn("Test Warning 2")
+
+	checkLines := []string{
+		"WARN     : Test Warning",
+		"TRACE(2) : Trace 2",
+		"WARN     : Test Warning 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestLoadConfig checks that settings can be read from a reader, that the
+// environment variables still take precedence, and that an invalid
+// configuration is rejected.
+func TestLoadConfig(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "2"
+	initialize(conf, true)
+
+	err := LoadConfig(strings.NewReader(`
+# Settings from memory
+RLOG_LOG_LEVEL = WARN
+RLOG_TRACE_LEVEL = 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info")
+	Warn("Test Warning")
+	Trace(2, "Trace 2")
+
+	if err := LoadConfig(strings.NewReader("!RLOG_LOG_LEVEL=LOUD")); err == nil {
+		t.Fatal("Invalid config should have been rejected")
+	}
+	if err := LoadConfig(strings.NewReader("RLOG_LOG_LEVLE=DEBUG")); err == nil {
+		t.Fatal("Unknown setting should have been rejected")
+	}
+	Info("Test Info 2")
+	Warn("Test Warning 2")
+
+	// A config file replaces the loaded settings, which are kept otherwise.
+	confFile := writeLogfile([]string{"RLOG_LOG_LEVEL=ERROR"})
+	defer os.Remove(confFile)
+	SetConfFile(confFile)
+	Warn("Test Warning 3")
+	Error("Test Error")
+	Trace(1, "Trace 1")
+	if configFromEnvVars.logLevel != "" {
+		t.Fatal("Loaded settings were stored as environment variables")
+	}
+
+	checkLines := []string{
+		"WARN     : Test Warning",
+		"TRACE(2) : Trace 2",
+		"WARN     : Test Warning 2",
+		"ERROR    : Test Error",
+		"TRACE(1) : Trace 1",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetTraceOutput checks that trace messages can be sent to their own
+// writer.
+func TestSetTraceOutput(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "2"
+	initialize(conf, true)
+
+	var buf bytes.Buffer
+	SetTraceOutput(&buf)
+	Info("Test Info")
+	Trace(1, "Trace 1")
+	SetTraceOutput(nil)
+	Trace(2, "Trace 2")
+
+	if buf.String() != "TRACE(1) : Trace 1\n" {
+		t.Fatalf("Incorrect trace output: %q", buf.String())
+	}
+	checkLines := []string{
+		"INFO     : Test Info",
+		"TRACE(2) : Trace 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestBoolStrings checks which strings are recognized as 'true' or 'false'.
+func TestBoolStrings(t *testing.T) {
+	tests := []struct {
+		str     string
+		isTrue  bool
+		isFalse bool
+	}{
+		{"on", true, false},
+		{"ON", true, false},
+		{"off", false, true},
+		{"yes", true, false},
+		{"Y", true, false},
+		{"no", false, true},
+		{"1", true, false},
+		{"0", false, true},
+		{"true", true, false},
+		{"False", false, true},
+		{"", false, false},
+		{"maybe", false, false},
+	}
+	for _, test := range tests {
+		if isTrueBoolString(test.str) != test.isTrue || isFalseBoolString(test.str) != test.isFalse {
+			t.Fatalf("Incorrect result for '%s'", test.str)
+		}
+	}
+}
+
+// TestShowSeq checks that logged messages are numbered without gaps.
+func TestShowSeq(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.showSeq = "yes"
+	initialize(conf, true)
+
+	var seqs []uint64
+	defer AddRecordHook(func(r Record) { seqs = append(seqs, r.Seq) })()
+	Info("Test Info 1")
+	Debug("Test Debug")
+	Info("Test Info 2")
+
+	if len(seqs) != 2 || seqs[0] == 0 || seqs[1] != seqs[0]+1 {
+		t.Fatalf("Incorrect sequence numbers: %v", seqs)
+	}
+	checkLines := []string{
+		fmt.Sprintf("#%d INFO     : Test Info 1", seqs[0]),
+		fmt.Sprintf("#%d INFO     : Test Info 2", seqs[1]),
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSplitStreams checks that warnings and errors go to stderr and all other
+// messages to stdout, if the streams are split.
+func TestSplitStreams(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	outFile := writeLogfile(nil)
+	errFile := writeLogfile(nil)
+	defer os.Remove(outFile)
+	defer os.Remove(errFile)
+	os.Stdout, _ = os.OpenFile(outFile, os.O_WRONLY, 0)
+	os.Stderr, _ = os.OpenFile(errFile, os.O_WRONLY, 0)
+
+	conf.logStream = "STDERR"
+	conf.logFile = ""
+	conf.splitStreams = "on"
+	initialize(conf, true)
+	Info("Test Info")
+	Warn("Test Warning")
+	Error("Test Error")
+	os.Stdout.Close()
+	os.Stderr.Close()
+	os.Stdout, os.Stderr = stdout, stderr
+
+	for name, should := range map[string]string{
+		outFile: "INFO     : Test Info\n",
+		errFile: "WARN     : Test Warning\nERROR    : Test Error\n",
+	} {
+		if content, _ := ioutil.ReadFile(name); string(content) != should {
+			t.Fatalf("Incorrect output %q. Should be: %q", content, should)
+		}
+	}
+}
+
+// TestSetClock checks that time stamps and timers use the clock set via
+// SetClock().
+func TestSetClock(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	conf.logNoTime = "false"
+	conf.logTimeFormat = "RFC3339"
+	initialize(conf, true)
+
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	stop := Timer("Test Timer")
+	now = now.Add(3 * time.Second)
+	stop()
+
+	checkLines := []string{
+		"2017-03-04T05:06:10Z DEBUG    : Test Timer elapsed=3s",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetTimeSeq checks that messages with the same time stamp are numbered.
+func TestSetTimeSeq(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetTimeSeq(false)
+
+	conf.logNoTime = "false"
+	conf.logTimeFormat = "RFC3339"
+	initialize(conf, true)
+
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	SetTimeSeq(true)
+	Info("Test Info 1")
+	now = now.Add(time.Millisecond)
+	Info("Test Info 2")
+	now = now.Add(time.Second)
+	Info("Test Info 3")
+	SetTimeSeq(false)
+	Info("Test Info 4")
+
+	checkLines := []string{
+		"2017-03-04T05:06:07Z [1] INFO     : Test Info 1",
+		"2017-03-04T05:06:07Z [2] INFO     : Test Info 2",
+		"2017-03-04T05:06:08Z [1] INFO     : Test Info 3",
+		"2017-03-04T05:06:08Z INFO     : Test Info 4",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestLevelNumeric checks that levels can be shown as rlog or syslog numbers.
+func TestLevelNumeric(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "1"
+	conf.levelNumeric = "yes"
+	initialize(conf, true)
+	Error("Test Error")
+	Trace(1, "Trace 1")
+
+	conf.levelNumeric = "syslog"
+	initialize(conf, true)
+	Error("Test Error")
+	Trace(1, "Trace 1")
+
+	checkLines := []string{
+		"2        : Test Error",
+		"6(1)     : Trace 1",
+		"3        : Test Error",
+		"7(1)     : Trace 1",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetFileHeader checks that the header line is only written to empty
+// logfiles.
+func TestSetFileHeader(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	SetFileHeader("level,message")
+	defer SetFileHeader("")
+	Info("Test Info")
+
+	// The header isn't written again, when the logfile is opened again.
+	initialize(conf, true)
+	Info("Test Info 2")
+
+	checkLines := []string{
+		"level,message",
+		"INFO     : Test Info",
+		"INFO     : Test Info 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetGlobalMinLevel checks that messages below the global minimum level
+// are dropped, regardless of the filters.
+func TestSetGlobalMinLevel(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	conf.traceLevel = "1"
+	initialize(conf, true)
+
+	if err := SetGlobalMinLevel("TRACE"); err == nil {
+		t.Fatal("TRACE should have been rejected")
+	}
+	if err := SetGlobalMinLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	Debug("Test Debug")
+	Info("Test Info")
+	Warn("Test Warning")
+	Trace(1, "Trace 1")
+	SetGlobalMinLevel("")
+	Info("Test Info 2")
+
+	checkLines := []string{
+		"WARN     : Test Warning",
+		"TRACE(1) : Trace 1",
+		"INFO     : Test Info 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestFieldArgs checks that Field arguments are logged as fields, rather than
+// as part of the message.
+func TestFieldArgs(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	Info("Test Info", F("user", 42), F("action", "login"))
+	Infof("Test %s", F("user", 42), "Info")
+	Warn(F("empty", true))
+
+	checkLines := []string{
+		"INFO     : Test Info action=login user=42",
+		"INFO     : Test Info user=42",
+		"WARN     :  empty=true",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetSkipEmpty checks that messages without text and fields are logged as
+// usual by default, and dropped if requested.
+func TestSetSkipEmpty(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetSkipEmpty(false)
+
+	initialize(conf, true)
+	Info()
+	Infof("")
+	SetSkipEmpty(true)
+	Info()
+	Infof("")
+	Warn(F("empty", true))
+	Infof("Test %s", "Info")
+
+	checkLines := []string{
+		"INFO     : ",
+		"INFO     : ",
+		"WARN     :  empty=true",
+		"INFO     : Test Info",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestToWriter checks that a message is written to the writer passed with
+// ToWriter() as well, even if all other output is discarded.
+func TestToWriter(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	var audit bytes.Buffer
+	Info("Test Info", ToWriter(&audit), F("user", 42))
+	Debug("Test Debug", ToWriter(&audit))
+	Info("Test Info 2")
+
+	checkLines := []string{
+		"INFO     : Test Info user=42",
+		"INFO     : Test Info 2",
+	}
+	fileMatch(t, checkLines, "")
+	if audit.String() != "INFO     : Test Info user=42\n" {
+		t.Fatalf("Incorrect extra output: %q", audit.String())
+	}
+
+	Discard()
+	audit.Reset()
+	Errorf("Test %s", ToWriter(&audit), "Error")
+	if audit.String() != "ERROR    : Test Error\n" {
+		t.Fatalf("Incorrect extra output: %q", audit.String())
+	}
+}
+
+// TestFileBuffer checks that buffered output is written to the logfile when
+// flushed, or when the logfile is replaced.
+func TestFileBuffer(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	Info("Test Info 1")
+	if content, _ := ioutil.ReadFile(logfile); len(content) != 0 {
+		t.Fatalf("Output should have been buffered: %q", content)
+	}
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info 2")
+	conf.fileBufferKB = ""
+	initialize(conf, true)
+
+	checkLines := []string{
+		"INFO     : Test Info 1",
+		"INFO     : Test Info 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestFileBufferChange checks that a changed buffer size is applied, even if
+// the logfile stays the same.
+func TestFileBufferChange(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	Info("Test Info 1")
+	if content, _ := ioutil.ReadFile(logfile); len(content) != 0 {
+		t.Fatalf("Output should have been buffered: %q", content)
+	}
+	conf.fileBufferKB = ""
+	initialize(conf, true)
+	Info("Test Info 2")
+	if files := countOpenFiles(t, logfile); files != 1 {
+		t.Fatalf("Logfile is open %d times", files)
+	}
+
+	checkLines := []string{
+		"INFO     : Test Info 1",
+		"INFO     : Test Info 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetFlushInterval checks that buffered output is written to the logfile
+// periodically, unless this is disabled.
+func TestSetFlushInterval(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetFlushInterval(time.Second)
+
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	SetFlushInterval(0)
+	Info("Test Info 1")
+	time.Sleep(50 * time.Millisecond)
+	if content, _ := ioutil.ReadFile(logfile); len(content) != 0 {
+		t.Fatalf("Output shouldn't have been flushed: %q", content)
+	}
+	SetFlushInterval(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if content, _ := ioutil.ReadFile(logfile); len(content) == 0 {
+		t.Fatal("Output wasn't flushed")
+	}
+
+	conf.fileBufferKB = ""
+	initialize(conf, true)
+}
+
+// TestRegisterExitFlush checks that buffered output is flushed when the
+// program receives an interrupt.
+func TestRegisterExitFlush(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetFlushInterval(time.Second)
+
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	SetFlushInterval(0)
+	stop := RegisterExitFlush(false)
+	defer stop()
+	Info("Test Info")
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skip("Can't send an interrupt on this platform:", err)
+	}
+	for i := 0; i < 100; i++ {
+		if content, _ := ioutil.ReadFile(logfile); len(content) != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+	checkLines := []string{"INFO     : Test Info"}
+	fileMatch(t, checkLines, "")
+
+	conf.fileBufferKB = ""
+	initialize(conf, true)
+}
+
+// TestLogLevel checks logging with a level value, including unknown levels.
+func TestLogLevel(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	LogLevel(ErrorLevel, "Test Error")
+	LogLevel(DebugLevel, "Test Debug")
+	LogLevel(Level(levelTrace), "Test Trace")
+	LogLevel(WarnLevel, "Test Warning")
+	LogLevel(Level(-3), "Test Unknown")
+	LogLevel(Level(42), "Test Unknown 2")
+	SetUnknownLevelName("CUSTOM")
+	defer SetUnknownLevelName("LOG")
+	LogLevel(Level(-1), "Test Unknown 3")
+
+	checkLines := []string{
+		"ERROR    : Test Error",
+		"WARN     : Test Warning",
+		"LOG      : Test Unknown",
+		"CUSTOM   : Test Unknown 3",
+	}
+	fileMatch(t, checkLines, "")
+	if s := InfoLevel.String(); s != "INFO" {
+		t.Fatalf("Incorrect name of INFO level: %s", s)
+	}
+}
+
+// TestTemplates checks that placeholders in templates are replaced by the
+// values of the fields.
+func TestTemplates(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "1"
+	initialize(conf, true)
+	Infot("{user} did {action} {unknown} {", Fields{"user": "bob", "action": 42})
+	Errort("No placeholders", nil)
+	Tracet(1, "{a}{a}", Fields{"a": "x"})
+	Debugt("Test Debug", nil)
+
+	checkLines := []string{
+		"INFO     : bob did 42 {unknown} { action=42 user=bob",
+		"ERROR    : No placeholders",
+		"TRACE(1) : xx a=x",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// nilError is an error type, whose Error() method fails for nil pointers.
+type nilError struct{ msg string }
+
+func (e *nilError) Error() string { return e.msg }
+
+// panicStringer is a type, whose String() method always panics.
+type panicStringer struct{}
+
+func (panicStringer) String() string { panic("boom") }
+
+// TestSpecialArguments checks that nil arguments, nil errors and panicking
+// String() methods neither break the message, nor the program.
+func TestSpecialArguments(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	var err error = (*nilError)(nil)
+	Info(nil)
+	Info("Error:", err)
+	Infof("Error: %v", err)
+	Info("Value:", panicStringer{})
+
+	checkLines := []string{
+		"INFO     : <nil>",
+		"INFO     : Error: <nil>",
+		"INFO     : Error: <nil>",
+		"INFO     : Value: %!v(PANIC=String method: boom)",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// nestedPanicStringer is a type, whose String() method panics with a value,
+// which can't be printed either. fmt doesn't recover from this.
+type nestedPanicStringer struct{}
+
+func (nestedPanicStringer) String() string { panic(nestedPanicStringer{}) }
+
+// panicFormatter is a Formatter, which always panics.
+type panicFormatter struct{}
+
+func (panicFormatter) Format(r Record) string { panic("boom") }
+
+// TestFormattingPanics checks that panics while formatting a message are
+// recovered, and that the message is still logged.
+func TestFormattingPanics(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetFormatter(nil)
+
+	initialize(conf, true)
+	Info("Value:", nestedPanicStringer{})
+	Errorf("Value: %s", nestedPanicStringer{})
+	SetFormatter(panicFormatter{})
+	Warn("Test Warning")
+
+	checkLines := []string{
+		"INFO     : %!PANIC(formatting error: rlog.nestedPanicStringer)",
+		"ERROR    : %!PANIC(formatting error: rlog.nestedPanicStringer)",
+		"WARN     : Test Warning %!PANIC(formatter error: string)",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetArgSeparator checks that arguments are joined with the separator.
+func TestSetArgSeparator(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetArgSeparator(" ")
+
+	initialize(conf, true)
+	SetArgSeparator("")
+	Info("a", 1, "b")
+	SetArgSeparator(", ")
+	Info("a", 1, "b", F("key", 2))
+	Infof("%s %d", "c", 3)
+	SetArgSeparator(" ")
+	Info("a", 1, "b")
+
+	checkLines := []string{
+		"INFO     : a1b",
+		"INFO     : a, 1, b key=2",
+		"INFO     : c 3",
+		"INFO     : a 1 b",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestTraceOrDebug checks that trace messages, which aren't traced, are logged
+// as debug messages instead.
+func TestTraceOrDebug(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	conf.traceLevel = "2"
+	initialize(conf, true)
+	TraceOrDebug(2, "Trace 2")
+	TraceOrDebug(3, "Trace 3")
+
+	conf.logLevel = "INFO"
+	conf.traceLevel = ""
+	initialize(conf, true)
+	TraceOrDebug(1, "Trace 1")
+
+	checkLines := []string{
+		"TRACE(2) : Trace 2",
+		"DEBUG    : Trace 3",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetLineTransform checks that the final log lines can be transformed or
+// skipped.
+func TestSetLineTransform(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	SetLineTransform(func(line string) string {
+		if strings.Contains(line, "skip") {
+			return ""
+		}
+		return "<14>" + strings.Replace(line, "secret", "******", -1)
+	})
+	Info("Test Info with secret")
+	Info("Test Info to skip")
+	SetLineTransform(nil)
+	Info("Test Info")
+
+	checkLines := []string{
+		"<14>INFO     : Test Info with ******",
+		"INFO     : Test Info",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestStrict checks that a configuration without output is reported once in
+// strict mode.
+func TestStrict(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	Discard()
+	conf.logFile = ""
+	initialize(conf, true)
+	if outputDisabledReported {
+		t.Fatal("Disabled output should only be reported in strict mode")
+	}
+	conf.strict = "yes"
+	initialize(conf, true)
+	if !outputDisabledReported {
+		t.Fatal("Disabled output wasn't reported")
+	}
+	conf.logFile = logfile
+	initialize(conf, true)
+	if outputDisabledReported {
+		t.Fatal("Output isn't disabled")
+	}
+}
+
+// TestLogStreamNames checks that the log stream can be selected by name.
+func TestLogStreamNames(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logStream = "DISCARD"
+	initialize(conf, true)
+	if logWriterStream != nil {
+		t.Fatal("Stream output wasn't discarded")
+	}
+	conf.logStream = "STDOUT"
+	initialize(conf, true)
+	if logWriterStream == nil || logWriterStream.Writer() != os.Stdout {
+		t.Fatal("Stream output isn't stdout")
+	}
+	conf.logStream = "FOO"
+	initialize(conf, true)
+	if logWriterStream == nil || logWriterStream.Writer() != os.Stderr {
+		t.Fatal("Unknown stream didn't fall back to stderr")
+	}
+	if err := Reconfigure(Config{LogStream: "foo"}); err == nil {
+		t.Fatal("Unknown stream wasn't rejected")
+	}
+}
+
+// TestCycleLogLevel checks the cycle of global log levels, which is used for
+// SIGUSR1.
+func TestCycleLogLevel(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer func() { levelCycleIndex = -1 }()
+
+	initialize(conf, true)
+	levelCycleIndex = 1 // INFO
+	for _, expected := range []string{"DEBUG", "TRACE", "WARN", "INFO"} {
+		if level := cycleLogLevel(); level != expected {
+			t.Fatalf("Expected level %s, but got %s", expected, level)
+		}
+	}
+
+	cycleLogLevel()
+	cycleLogLevel()
+	Trace(4, "Test trace")
+	Debug("Test debug")
+	cycleLogLevel()
+	Trace(4, "Test trace 2")
+	Info("Test info")
+	Warn("Test warn")
+	checkLines := []string{
+		"TRACE(4) : Test trace",
+		"DEBUG    : Test debug",
+		"WARN     : Test warn",
+	}
+	fileMatch(t, checkLines, "")
+
+	// A global level in RLOG_LOG_LEVEL is replaced as well, also when the
+	// configuration is read again. The cycle starts at that level.
+	os.Remove(logfile)
+	conf.logLevel = "WARN,client.go=ERROR"
+	initialize(conf, true)
+	if levelCycleIndex = currentLevelCycleIndex(); levelCycle[levelCycleIndex] != "WARN" {
+		t.Fatalf("Cycle should start at WARN, not %s", levelCycle[levelCycleIndex])
+	}
+	cycleLogLevel()
+	initialize(conf, false)
+	Info("Test info")
+	Debug("Test debug")
+	if s := fmt.Sprint(LogFilters()); s != "[client.go=2 4]" {
+		t.Fatalf("Incorrect log filters: %s", s)
+	}
+	fileMatch(t, []string{"INFO     : Test info"}, "")
+
+	// The global trace level of RLOG_TRACE_LEVEL is restored when leaving
+	// TRACE.
+	os.Remove(logfile)
+	conf.logLevel = "DEBUG"
+	conf.traceLevel = "2"
+	initialize(conf, true)
+	levelCycleIndex = 2 // DEBUG
+	cycleLogLevel()
+	Trace(4, "Trace 4")
+	cycleLogLevel()
+	Trace(2, "Trace 2")
+	Trace(3, "Trace 3")
+	checkLines = []string{
+		"TRACE(4) : Trace 4",
+		"TRACE(2) : Trace 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestExpandStructs checks that struct and map arguments are shown as sorted
+// key/value pairs, if enabled.
+func TestExpandStructs(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetExpandStructs(false)
+
+	type point struct {
+		Y, X int
+		tags []string
+	}
+	p := point{2, 1, []string{"a", "b"}}
+	initialize(conf, true)
+	Info("Point", p)
+	SetExpandStructs(true)
+	Info("Point", p)
+	Info("Pointer", &p, "map", map[string]int{"b": 2, "a": 1})
+	Info("Time", time.Duration(0), "empty", struct{}{})
+	Infof("Format %v", p)
+
+	checkLines := []string{
+		"INFO     : Point {2 1 [a b]}",
+		"INFO     : Point X=1 Y=2 tags=[a b]",
+		"INFO     : Pointer X=1 Y=2 tags=[a b] map a=1 b=2",
+		"INFO     : Time 0s empty {}",
+		"INFO     : Format {2 1 [a b]}",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSetLinePrefix checks that the line prefix is written before the time
+// stamp, to the stream and the logfile.
+func TestSetLinePrefix(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetLinePrefix("")
+
+	conf.logNoTime = ""
+	conf.logTimeFormat = "2006"
+	initialize(conf, true)
+	var buf bytes.Buffer
+	logWriterStream = log.New(&buf, "", 0)
+	SetLinePrefix("app1 ")
+	Info("Test Info")
+
+	year := time.Now().Format("2006")
+	expected := "app1 " + year + " INFO     : Test Info\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected stream output '%s', but got '%s'", expected, buf.String())
+	}
+	content, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("Expected logfile content '%s', but got '%s'", expected, content)
+	}
+}
+
+// TestFatal checks that fatal messages are logged and flushed before the
+// program exits with the configured code.
+func TestFatal(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer func() { osExit = os.Exit }()
+	defer SetFatalExitCode(1)
+
+	var codes []int
+	osExit = func(code int) {
+		codes = append(codes, code)
+	}
+	conf.fileBufferKB = "4"
+	initialize(conf, true)
+	Fatal("Test Fatal")
+	checkLines := []string{
+		"CRITICAL : Test Fatal",
+	}
+	fileMatch(t, checkLines, "")
+
+	SetFatalExitCode(3)
+	Fatalf("Test %s", "Fatalf")
+	FatalCode(4, "Test FatalCode")
+	if len(codes) != 3 || codes[0] != 1 || codes[1] != 3 || codes[2] != 4 {
+		t.Fatalf("Incorrect exit codes: %v", codes)
+	}
+}
+
+// TestSetErrorFile checks that severe messages are also written to the error
+// file.
+func TestSetErrorFile(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	errorFile := logfile + ".errors"
+	defer os.Remove(errorFile)
+	conf.traceLevel = "1"
+	initialize(conf, true)
+	if err := SetErrorFile(errorFile, "TRACE"); err == nil {
+		t.Fatal("TRACE should have been rejected")
+	}
+	if err := SetErrorFile(errorFile, "error"); err != nil {
+		t.Fatal(err)
+	}
+	Info("Test Info")
+	Error("Test Error")
+	Trace(1, "Trace 1")
+	Critical("Test Critical")
+	if err := SetErrorFile("", ""); err != nil {
+		t.Fatal(err)
+	}
+	Error("Test Error 2")
+
+	checkLines := []string{
+		"INFO     : Test Info",
+		"ERROR    : Test Error",
+		"TRACE(1) : Trace 1",
+		"CRITICAL : Test Critical",
+		"ERROR    : Test Error 2",
+	}
+	fileMatch(t, checkLines, "")
+	content, err := ioutil.ReadFile(errorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ERROR    : Test Error\nCRITICAL : Test Critical\n"
+	if string(content) != expected {
+		t.Fatalf("Expected error file content '%s', but got '%s'", expected, content)
+	}
+}
+
+// TestReopenErrorFile checks that the file set via SetErrorFile() is reopened
+// together with the logfile.
+func TestReopenErrorFile(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	errorFile := logfile + ".errors"
+	rotated := errorFile + ".1"
+	defer os.Remove(errorFile)
+	defer os.Remove(rotated)
+	initialize(conf, true)
+	if err := SetErrorFile(errorFile, "ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetErrorFile("", "")
+
+	Error("Test Error 1")
+	if err := os.Rename(errorFile, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	Error("Test Error 2")
+
+	content, err := ioutil.ReadFile(errorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "ERROR    : Test Error 2\n" {
+		t.Fatalf("Incorrect content of reopened error file: %q", content)
+	}
+}
+
+// TestTraceLevelRange checks that trace levels outside of the valid range are
+// clamped or rejected, and that keywords can be used instead of numbers.
+func TestTraceLevelRange(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.traceLevel = "0"
+	initialize(conf, true)
+	Trace(0, "Trace 0")
+	Trace(-5, "Trace -5")
+	Trace(1, "Trace 1")
+
+	conf.traceLevel = "99999"
+	initialize(conf, true)
+	Trace(1000000, "Trace 1000000")
+
+	checkLines := []string{
+		"TRACE(0) : Trace 0",
+		"TRACE(0) : Trace -5",
+		"TRACE(1000): Trace 1000000",
+	}
+	fileMatch(t, checkLines, "")
+
+	if _, err := ParseTraceSpec("-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTraceSpec("client.go=-2"); err == nil {
+		t.Fatal("Trace level -2 should have been rejected")
+	}
+	filters, err := ParseTraceSpec("1000000")
+	if err != nil || filters[0].Level != maxTraceLevel {
+		t.Fatalf("Trace level wasn't clamped: %v %v", filters, err)
+	}
+
+	filters, err = ParseTraceSpec("client.go=all,server.go=Off,MAX")
+	if err != nil || len(filters) != 3 || filters[0].Level != maxTraceLevel ||
+		filters[1].Level != noTraceOutput || filters[2].Level != maxTraceLevel {
+		t.Fatalf("Keywords weren't recognized: %v %v", filters, err)
+	}
+	if filters, err = ParseTraceSpec("NONE"); err != nil || len(filters) != 0 {
+		t.Fatalf("NONE didn't disable tracing: %v %v", filters, err)
+	}
+	if _, err := ParseTraceSpec("client.go=SOME"); err == nil {
+		t.Fatal("Unknown keyword should have been rejected")
+	}
+}
+
+// TestSetFilterFunc checks that a filter function is asked before the
+// configured filters, which still decide if it doesn't match.
+func TestSetFilterFunc(t *testing.T) {
+	skipWithoutCallerLookup(t)
+	conf := setup()
+	defer cleanup()
+	defer SetFilterFunc(nil)
+	defer SetTraceFilterFunc(nil)
+
+	initialize(conf, true)
+	SetFilterFunc(func(file, funcName string, level int) (bool, bool) {
+		if strings.HasSuffix(funcName, "TestSetFilterFunc") && Level(level) == DebugLevel {
+			return true, true
+		}
+		if Level(level) == ErrorLevel {
+			return true, false
+		}
+		return false, false
+	})
+	SetTraceFilterFunc(func(file, funcName string, level int) (bool, bool) {
+		return path.Base(file) == "rlog_test.go", level <= 2
+	})
+	Debug("Test Debug")
+	Error("Test Error")
+	Info("Test Info")
+	Trace(2, "Trace 2")
+	Trace(3, "Trace 3")
+
+	checkLines := []string{
+		"DEBUG    : Test Debug",
+		"INFO     : Test Info",
+		"TRACE(2) : Trace 2",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestLiteralFiles checks that specs with only literal filenames are indexed
+// for a quick exit, while filtering itself is unchanged.
+func TestLiteralFiles(t *testing.T) {
+	tests := []struct {
+		spec    string
+		indexed bool
+	}{
+		{"client.go=3,server.go=2", true},
+		{"client.go=3,2", false},
+		{"client*.go=3", false},
+		{"func:Handle=3", false},
+		{"pkg:auth=3", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		spec := new(filterSpec)
+		spec.fromString(test.spec, true, noTraceOutput)
+		if (spec.literalFiles != nil) != test.indexed {
+			t.Fatalf("Incorrect index for '%s': %v", test.spec, spec.literalFiles)
+		}
+	}
+
+	spec := new(filterSpec)
+	spec.fromString("client.go=3,server.go=2", true, noTraceOutput)
+	if !spec.matchfilters("foo/client.go", "foo.Func", 3) ||
+		spec.matchfilters("foo/server.go", "foo.Func", 3) ||
+		spec.matchfilters("foo/conn.go", "foo.Func", 1) {
+		t.Fatal("Incorrect filter result")
+	}
+	if spec.withGlobalLevel(1).literalFiles != nil {
+		t.Fatal("Spec with global level must not be indexed")
+	}
+}
+
+// TestLevelEnabled pins the meaning of the level numbers: A configured level
+// enables all levels, which are at least as severe, and trace levels up to and
+// including the configured one.
+func TestLevelEnabled(t *testing.T) {
+	severity := []int{levelCrit, levelErr, levelWarn, levelInfo, levelDebug, levelTrace}
+	for i, configured := range severity {
+		for j, message := range severity {
+			if levelEnabled(message, configured) != (j <= i) {
+				t.Fatalf("Level %s with configured level %s: Expected %v",
+					levelStrings[message], levelStrings[configured], j <= i)
+			}
+		}
+		if levelEnabled(configured, levelNone) {
+			t.Fatalf("Level %s must not be enabled by NONE", levelStrings[configured])
+		}
+	}
+	for traceLevel := 0; traceLevel <= 5; traceLevel++ {
+		if !levelEnabled(traceLevel, 3) != (traceLevel > 3) {
+			t.Fatalf("Trace level %d with configured trace level 3", traceLevel)
+		}
+		if levelEnabled(traceLevel, noTraceOutput) {
+			t.Fatalf("Trace level %d must not be enabled without trace output", traceLevel)
+		}
+	}
+
+	// The same has to hold for filters, as parsed from the configuration.
+	spec := new(filterSpec)
+	spec.fromString("WARN,client.go=DEBUG", false, levelInfo)
+	tests := []struct {
+		file  string
+		level int
+		allow bool
+	}{
+		{"foo/server.go", levelCrit, true},
+		{"foo/server.go", levelWarn, true},
+		{"foo/server.go", levelInfo, false},
+		{"foo/server.go", levelDebug, false},
+		{"foo/client.go", levelDebug, true},
+		{"foo/client.go", levelTrace, false},
+	}
+	for _, test := range tests {
+		if spec.matchfilters(test.file, "foo.Func", test.level) != test.allow {
+			t.Fatalf("Level %s for '%s': Expected %v", levelStrings[test.level], test.file, test.allow)
+		}
+	}
+	spec = new(filterSpec)
+	spec.fromString("2", true, noTraceOutput)
+	if !spec.matchGlobalFilter(0) || !spec.matchGlobalFilter(2) || spec.matchGlobalFilter(3) {
+		t.Fatal("Incorrect trace filter result")
+	}
+}
+
+// BenchmarkNamedTraceFilters measures trace filtering for many files, when
+// only a few of them are traced by named filters.
+func BenchmarkNamedTraceFilters(b *testing.B) {
+	spec := new(filterSpec)
+	spec.fromString("client.go=3,server.go=2,conn.go=1", true, noTraceOutput)
+
+	filenames := make([]string, 100)
+	for i := range filenames {
+		filenames[i] = fmt.Sprintf("github.com/foo/bar/file%d.go", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		spec.matchfilters(filenames[i%len(filenames)], "bar.Func", 1)
+	}
 }
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build !rlog_nocaller
+
+package rloghttp
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/romana/rlog"
+	"github.com/romana/rlog/rlogtest"
+)
+
+// TestLogRequestCaller checks that requests are attributed to rloghttp.go,
+// unless the package is listed in RLOG_SKIP_PACKAGES. Since this test is part
+// of the package, it's skipped as well then.
+func TestLogRequestCaller(t *testing.T) {
+	state := rlog.Snapshot()
+	defer rlog.Restore(state)
+	hook := rlogtest.InstallTestHook(t)
+
+	for _, skip := range []string{"", "github.com/romana/rlog/rloghttp"} {
+		hook.Reset()
+		err := rlog.Reconfigure(rlog.Config{LogStream: "none", CallerInfo: "true", SkipPackages: skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		LogRequest(httptest.NewRequest("GET", "/", nil), 200, time.Second)
+		file := "rloghttp/rloghttp.go"
+		if skip != "" {
+			file = "testing/testing.go"
+		}
+		if records := hook.Records(); len(records) != 1 || records[0].File != file {
+			t.Fatalf("Incorrect caller with skipped packages '%s': %+v", skip, records)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package rloghttp logs HTTP requests via rlog, for example from a middleware
+// of a web service:
+//
+//	func logged(next http.Handler) http.Handler {
+//	    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	        start := time.Now()
+//	        // statusRecorder is a ResponseWriter, which remembers the status.
+//	        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+//	        next.ServeHTTP(rec, r)
+//	        rloghttp.LogRequest(r, rec.status, time.Since(start))
+//	    })
+//	}
+//
+// It's a separate package, so that rlog itself doesn't depend on net/http.
+//
+// The requests are logged from within this package, so the caller information
+// and the per-file filters of RLOG_LOG_LEVEL see rloghttp.go as the caller,
+// not the middleware. This allows the request log to be filtered as a whole,
+// for example with "rloghttp.go=WARN" to log failed requests only. To
+// attribute the messages to the middleware instead, add this package to
+// RLOG_SKIP_PACKAGES:
+//
+//	RLOG_SKIP_PACKAGES=github.com/romana/rlog/rloghttp
+package rloghttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/romana/rlog"
+)
+
+// LogRequest logs a handled HTTP request. The message has the fields method,
+// path, status, duration and remote, for the remote address. The level
+// depends on the status: ERROR for server errors (5xx), WARN for client errors
+// (4xx) and INFO otherwise. The caller of the message is rloghttp.go, unless
+// this package is listed in RLOG_SKIP_PACKAGES.
+func LogRequest(r *http.Request, status int, dur time.Duration) {
+	path := r.RequestURI
+	if r.URL != nil {
+		path = r.URL.Path
+	}
+	args := []interface{}{
+		"HTTP request",
+		rlog.F("method", r.Method),
+		rlog.F("path", path),
+		rlog.F("status", status),
+		rlog.F("duration", dur),
+		rlog.F("remote", r.RemoteAddr),
+	}
+	switch {
+	case status >= 500:
+		rlog.Error(args...)
+	case status >= 400:
+		rlog.Warn(args...)
+	default:
+		rlog.Info(args...)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rloghttp
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/romana/rlog/rlogtest"
+)
+
+// TestLogRequest checks the level and fields of logged requests.
+func TestLogRequest(t *testing.T) {
+	hook := rlogtest.InstallTestHook(t)
+	tests := []struct {
+		status int
+		level  string
+	}{
+		{200, "INFO"},
+		{302, "INFO"},
+		{404, "WARN"},
+		{503, "ERROR"},
+	}
+	for _, test := range tests {
+		hook.Reset()
+		r := httptest.NewRequest("GET", "/users?id=1", nil)
+		LogRequest(r, test.status, time.Second)
+		records := hook.Records()
+		if len(records) != 1 || records[0].Level != test.level {
+			t.Fatalf("Incorrect records for status %d: %+v", test.status, records)
+		}
+		f := records[0].Fields
+		if f["method"] != "GET" || f["path"] != "/users" || f["status"] != test.status ||
+			f["duration"] != time.Second || f["remote"] != "192.0.2.1:1234" {
+			t.Fatalf("Incorrect fields: %v", f)
+		}
+	}
+}
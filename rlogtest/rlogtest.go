@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package rlogtest helps with testing code, which logs via rlog. A TestHook
+// records the messages logged during a test, so that the test can check them:
+//
+//	func TestLogin(t *testing.T) {
+//	    hook := rlogtest.InstallTestHook(t)
+//	    login("unknown user")
+//	    hook.AssertLogged(t, "ERROR", "unknown user")
+//	}
+//
+// Only messages that pass rlog's log and trace filters are recorded, so the
+// log level may need to be lowered to check DEBUG messages.
+package rlogtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/romana/rlog"
+)
+
+// TestHook records the log messages. It is installed via InstallTestHook().
+type TestHook struct {
+	mutex   sync.Mutex
+	records []rlog.Record
+}
+
+// InstallTestHook installs a new TestHook, which records all log messages
+// until the end of the test. It is removed automatically when the test and all
+// its subtests are done.
+func InstallTestHook(t testing.TB) *TestHook {
+	h := new(TestHook)
+	t.Cleanup(rlog.AddRecordHook(h.record))
+	return h
+}
+
+// record is the record hook, which stores a record.
+func (h *TestHook) record(r rlog.Record) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, r)
+}
+
+// Records returns the records of all messages, which were logged so far.
+func (h *TestHook) Records() []rlog.Record {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	records := make([]rlog.Record, len(h.records))
+	copy(records, h.records)
+	return records
+}
+
+// Reset forgets all messages, which were logged so far.
+func (h *TestHook) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = nil
+}
+
+// Logged returns true if a message with the given level ("TRACE", "DEBUG",
+// "INFO", "WARN", "ERROR" or "CRITICAL") was logged, which contains the given
+// substring.
+func (h *TestHook) Logged(level string, substring string) bool {
+	for _, r := range h.Records() {
+		if strings.EqualFold(r.Level, level) && strings.Contains(r.Message, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertLogged reports an error on t, if no message with the given level was
+// logged, which contains the given substring.
+func (h *TestHook) AssertLogged(t testing.TB, level string, substring string) {
+	t.Helper()
+	if !h.Logged(level, substring) {
+		t.Errorf("No %s message containing '%s' was logged", level, substring)
+	}
+}
+
+// AssertNotLogged reports an error on t, if a message with the given level was
+// logged, which contains the given substring.
+func (h *TestHook) AssertNotLogged(t testing.TB, level string, substring string) {
+	t.Helper()
+	if h.Logged(level, substring) {
+		t.Errorf("A %s message containing '%s' was logged", level, substring)
+	}
+}
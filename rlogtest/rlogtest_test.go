@@ -0,0 +1,69 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlogtest
+
+import (
+	"testing"
+
+	"github.com/romana/rlog"
+)
+
+// fakeT records errors reported by the assertions.
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+// TestTestHook checks that logged messages are recorded and found.
+func TestTestHook(t *testing.T) {
+	var hook *TestHook
+	t.Run("install", func(t *testing.T) {
+		hook = InstallTestHook(t)
+		rlog.Error("Test Error 42")
+		rlog.Debug("Test Debug")
+
+		hook.AssertLogged(t, "error", "Error 42")
+		hook.AssertNotLogged(t, "DEBUG", "Test Debug")
+
+		ft := new(fakeT)
+		hook.AssertLogged(ft, "WARN", "Error 42")
+		if !ft.failed {
+			t.Fatal("Missing message not reported")
+		}
+		ft = new(fakeT)
+		hook.AssertNotLogged(ft, "ERROR", "42")
+		if !ft.failed {
+			t.Fatal("Unexpected message not reported")
+		}
+
+		hook.Reset()
+		if len(hook.Records()) != 0 {
+			t.Fatal("Records not reset")
+		}
+	})
+
+	// The hook is removed at the end of the subtest.
+	rlog.Error("Test Error 43")
+	if hook.Logged("ERROR", "43") {
+		t.Fatal("Hook wasn't removed")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build !unix
+
+package rlog
+
+import (
+	"os"
+)
+
+// The signals, on which RegisterExitFlush() flushes the output.
+var exitSignals = []os.Signal{os.Interrupt}
+
+// raiseSignal terminates the program, since a process can't send a signal to
+// itself on this platform.
+func raiseSignal(sig os.Signal) {
+	osExit(1)
+}
+
+// installReopenHandler only reports that RLOG_SIGHUP_REOPEN can't be used,
+// since there is no SIGHUP on this platform.
+func installReopenHandler() {
+	rlogIssue("RLOG_SIGHUP_REOPEN is not supported on this platform.")
+}
+
+// installLevelCycleHandler only reports that RLOG_SIGUSR1_CYCLE can't be used,
+// since there is no SIGUSR1 on this platform.
+func installLevelCycleHandler() {
+	rlogIssue("RLOG_SIGUSR1_CYCLE is not supported on this platform.")
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build unix
+
+package rlog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The signals, on which RegisterExitFlush() flushes the output.
+var exitSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// raiseSignal sends a signal to the process itself, so that its default action
+// takes place, once nothing is registered for it via signal.Notify anymore.
+func raiseSignal(sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		syscall.Kill(os.Getpid(), s)
+	}
+}
+
+// installReopenHandler starts a goroutine, which reopens the logfile whenever
+// the process receives SIGHUP.
+func installReopenHandler() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := ReopenLogFile(); err != nil {
+				rlogIssue("%s", err)
+			}
+		}
+	}()
+}
+
+// installLevelCycleHandler starts a goroutine, which moves on to the next
+// global log level whenever the process receives SIGUSR1.
+func installLevelCycleHandler() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			rlogIssue("Log level set to %s via SIGUSR1.", cycleLogLevel())
+		}
+	}()
+}
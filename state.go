@@ -0,0 +1,264 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// State is a snapshot of the configuration of rlog, as returned by Snapshot().
+// It can be applied again with Restore().
+type State struct {
+	config               rlogConfig
+	loadedSettings       map[string]configSetting
+	traceLevelOverridden bool
+	traceLevelOverride   int
+	logLevelOverridden   bool
+	discardOverridden    bool
+	logLevelOverride     int
+	traceLoggedFiles     bool
+	traceLoggedLevel     int
+
+	// Output streams, which may have been changed at runtime.
+	stream io.Writer
+	info   io.Writer
+	trace  io.Writer
+	file   bool
+
+	// The file set via SetErrorFile(), which is opened again by name.
+	errorFile      string
+	errorFileLevel int
+
+	filterFunc        FilterFunc
+	traceFilterFunc   FilterFunc
+	formatter         Formatter
+	jsonPretty        bool
+	jsonSchema        string
+	otelExporter      OTelExporter
+	recordHooks       []*recordHook
+	channel           chan<- Record
+	channelBlock      bool
+	version           string
+	maxLevel          int
+	maxLevelDowngrade bool
+	minLevel          int
+	levelPrefixes     map[int]string
+	traceLevelFormat  func(int) string
+	traceHideLevel    bool
+	timeSeq           bool
+	lineTransform     func(line string) string
+	linePrefix        string
+	callerSuffix      bool
+	argSeparator      string
+	unknownLevelName  string
+	expandStructs     bool
+	skipEmpty         bool
+	sourceTrim        string
+	fileHeader        string
+	flushInterval     time.Duration
+	fatalExitCode     int
+	clock             func() time.Time
+}
+
+// Snapshot returns the current configuration of rlog: The settings from the
+// environment variables, changes made at runtime, the output streams, hooks
+// and formatters. This allows tests and libraries to change the configuration
+// temporarily and to go back to the previous one with Restore() afterwards.
+func Snapshot() State {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+
+	s := State{
+		config:               configFromEnvVars,
+		loadedSettings:       loadedSettings,
+		traceLevelOverridden: traceLevelOverridden,
+		traceLevelOverride:   traceLevelOverride,
+		logLevelOverridden:   logLevelOverridden,
+		discardOverridden:    discardOverridden,
+		logLevelOverride:     logLevelOverride,
+		traceLoggedFiles:     traceLoggedFilesEnabled,
+		traceLoggedLevel:     traceLoggedFilesLevel,
+		stream:               loggerWriter(logWriterStream),
+		info:                 loggerWriter(logWriterInfo),
+		trace:                loggerWriter(logWriterTrace),
+		file:                 logWriterFile != nil,
+		filterFunc:           settingFilterFunc,
+		traceFilterFunc:      settingTraceFilterFunc,
+		formatter:            settingFormatter,
+		jsonPretty:           settingJSONPretty,
+		jsonSchema:           settingJSONSchemaVersion,
+		otelExporter:         settingOTelExporter,
+		recordHooks:          append([]*recordHook(nil), recordHooks...),
+		channel:              channelOutput,
+		channelBlock:         channelOutputBlock,
+		version:              settingVersion,
+		maxLevel:             settingMaxLevel,
+		maxLevelDowngrade:    settingMaxLevelDowngrade,
+		minLevel:             settingMinLevel,
+		levelPrefixes:        make(map[int]string, len(levelPrefixes)),
+		traceLevelFormat:     settingTraceLevelFormat,
+		traceHideLevel:       settingTraceHideLevel,
+		timeSeq:              settingTimeSeq,
+		lineTransform:        settingLineTransform,
+		linePrefix:           settingLinePrefix,
+		callerSuffix:         settingCallerSuffix,
+		argSeparator:         settingArgSeparator,
+		unknownLevelName:     settingUnknownLevelName,
+		expandStructs:        settingExpandStructs,
+		skipEmpty:            settingSkipEmpty,
+		sourceTrim:           settingSourceTrim,
+		fileHeader:           settingFileHeader,
+		flushInterval:        settingFlushInterval,
+		fatalExitCode:        settingFatalExitCode,
+		clock:                clock,
+	}
+	for level, prefix := range levelPrefixes {
+		s.levelPrefixes[level] = prefix
+	}
+	if logWriterErrorFile != nil {
+		s.errorFile = logWriterErrorFile.Writer().(*logFileWriter).name
+		s.errorFileLevel = settingErrorFileLevel
+	}
+	return s
+}
+
+// Restore applies a configuration, which was saved with Snapshot(). The
+// logfile isn't part of the snapshot, it's opened again as configured, if
+// needed. If the logfile was switched off at the time of the snapshot, for
+// example via SetOutput(), it's closed. The same applies to the file set via
+// SetErrorFile().
+//
+// Hooks are restored as they were at the time of the snapshot, even if they
+// were removed since then. Not covered are the functions registered via
+// RegisterExitFlush(), the signal handlers of RLOG_SIGUSR1_CYCLE and
+// RLOG_SIGHUP_REOPEN, as well as counters and other state, such as sequence
+// numbers, Metrics(), LastError() and the state of DebugEvery() and friends.
+func Restore(s State) {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+
+	configFromEnvVars = s.config
+	loadedSettings = s.loadedSettings
+	settingFilterFunc = s.filterFunc
+	settingTraceFilterFunc = s.traceFilterFunc
+	settingFormatter = s.formatter
+	settingJSONPretty = s.jsonPretty
+	settingJSONSchemaVersion = s.jsonSchema
+	settingOTelExporter = s.otelExporter
+	recordHooks = append([]*recordHook(nil), s.recordHooks...)
+	channelOutput = s.channel
+	channelOutputBlock = s.channelBlock
+	settingVersion = s.version
+	settingVersionPrefix = ""
+	if s.version != "" {
+		settingVersionPrefix = "[" + s.version + "] "
+	}
+	settingMaxLevel = s.maxLevel
+	settingMaxLevelDowngrade = s.maxLevelDowngrade
+	settingMinLevel = s.minLevel
+	levelPrefixes = make(map[int]string, len(s.levelPrefixes))
+	for level, prefix := range s.levelPrefixes {
+		levelPrefixes[level] = prefix
+	}
+	settingTraceLevelFormat = s.traceLevelFormat
+	settingTraceHideLevel = s.traceHideLevel
+	settingTimeSeq = s.timeSeq
+	settingLineTransform = s.lineTransform
+	settingLinePrefix = s.linePrefix
+	settingCallerSuffix = s.callerSuffix
+	settingArgSeparator = s.argSeparator
+	settingUnknownLevelName = s.unknownLevelName
+	settingExpandStructs = s.expandStructs
+	settingSkipEmpty = s.skipEmpty
+	settingSourceTrim = s.sourceTrim
+	settingFileHeader = s.fileHeader
+	settingFlushInterval = s.flushInterval
+	settingFatalExitCode = s.fatalExitCode
+	clock = s.clock
+	resetCallerSites()
+
+	// The configuration determines the filters and the logfile. The levels
+	// set via EnableTrace(), EnableTraceForLoggedFiles() and SIGUSR1 are
+	// applied on top of it.
+	traceLevelOverridden = s.traceLevelOverridden
+	traceLevelOverride = s.traceLevelOverride
+	logLevelOverridden = s.logLevelOverridden
+	discardOverridden = s.discardOverridden
+	logLevelOverride = s.logLevelOverride
+	traceLoggedFilesEnabled = s.traceLoggedFiles
+	traceLoggedFilesLevel = s.traceLoggedLevel
+	applyConfig(s.config)
+	logWriterStream = newLogger(s.stream)
+	logWriterInfo = newLogger(s.info)
+	logWriterTrace = newLogger(s.trace)
+	if !s.file {
+		closeLogFileWriter()
+		logWriterFile = nil
+		closeCurrentLogFile()
+	}
+	// A logfile, which was kept by applyConfig, still flushes with the old
+	// interval.
+	if w := currentLogFileWriter(); w != nil && w.buf != nil {
+		w.stopFlushing()
+		w.startFlushing()
+	}
+	restoreErrorFile(s.errorFile, s.errorFileLevel)
+	checkOutputEnabled()
+}
+
+// restoreErrorFile opens the file, which was set via SetErrorFile() at the time
+// of a snapshot, unless it's still in use. The caller needs to hold the write
+// lock of initMutex.
+func restoreErrorFile(name string, level int) {
+	settingErrorFileLevel = level
+	if logWriterErrorFile != nil {
+		w := logWriterErrorFile.Writer().(*logFileWriter)
+		if w.name == name {
+			return
+		}
+		w.file.Close()
+		logWriterErrorFile = nil
+	}
+	if name == "" {
+		return
+	}
+	file, err := openLogFile(name)
+	if err != nil {
+		rlogIssue("Unable to open error file: %s", err)
+		setLastError(err)
+		return
+	}
+	writeFileHeader(file)
+	logWriterErrorFile = log.New(newLogFileWriter(name, file, 0), "", 0)
+}
+
+// loggerWriter returns the writer of a logger, or nil if there's no logger.
+func loggerWriter(l *log.Logger) io.Writer {
+	if l == nil {
+		return nil
+	}
+	return l.Writer()
+}
+
+// newLogger returns a logger for the writer, or nil if there's no writer.
+func newLogger(w io.Writer) *log.Logger {
+	if w == nil {
+		return nil
+	}
+	return log.New(w, "", 0)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestSnapshot checks that changes made after a snapshot are undone when it's
+// restored.
+func TestSnapshot(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	state := Snapshot()
+
+	var buf bytes.Buffer
+	hooked := 0
+	SetOutput(&buf)
+	SetFormatter(LogfmtFormatter{})
+	SetLinePrefix("prefix ")
+	SetLevelPrefix("INFO", "!")
+	EnableTrace(5)
+	AddRecordHook(func(r Record) { hooked++ })
+	Info("Test Info 1")
+	if buf.Len() == 0 || hooked != 1 {
+		t.Fatal("Changed configuration wasn't applied")
+	}
+
+	Restore(state)
+	buf.Reset()
+	Info("Test Info 2")
+	Trace(5, "Trace 5")
+	if buf.Len() != 0 || hooked != 1 {
+		t.Fatalf("Configuration wasn't restored: %q, %d hook calls", buf.String(), hooked)
+	}
+	checkLines := []string{"INFO     : Test Info 2"}
+	fileMatch(t, checkLines, "")
+}
+
+// TestSnapshotErrorFile checks that the file set via SetErrorFile() is opened
+// again when a snapshot is restored.
+func TestSnapshotErrorFile(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	errorFile := logfile + ".errors"
+	defer os.Remove(errorFile)
+	if err := SetErrorFile(errorFile, "ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetErrorFile("", "")
+	state := Snapshot()
+	SetErrorFile("", "")
+	Restore(state)
+	Error("Test Error")
+	Warn("Test Warning")
+
+	content, err := ioutil.ReadFile(errorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "ERROR    : Test Error\n" {
+		t.Fatalf("Incorrect content of error file: %q", content)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"io"
+	"os"
+)
+
+// IsTerminalOutput returns true if log messages are currently written to a
+// terminal. This allows a program to make the same decision as rlog, for
+// example to show progress bars only if a person is watching the output. If
+// the output was re-wired via SetOutput() to something other than a terminal,
+// or is discarded, this returns false.
+func IsTerminalOutput() bool {
+	initMutex.RLock()
+	defer initMutex.RUnlock()
+	return isTerminal(loggerWriter(logWriterStream))
+}
+
+// isTerminal returns true if the writer is a file, which refers to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	return isTerminalFile(f)
+}
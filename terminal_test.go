@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestIsTerminalOutput checks that writers, which aren't terminals, are
+// recognized as such. Whether the test itself runs in a terminal is unknown,
+// so only the negative cases can be checked.
+func TestIsTerminalOutput(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+	defer SetOutput(os.Stderr)
+
+	initialize(conf, true)
+	if IsTerminalOutput() {
+		t.Fatal("Output without a stream must not be a terminal")
+	}
+	SetOutput(&bytes.Buffer{})
+	if IsTerminalOutput() {
+		t.Fatal("A buffer must not be a terminal")
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	SetOutput(null)
+	if IsTerminalOutput() {
+		t.Fatal("The null device must not be a terminal")
+	}
+
+	file, err := os.Open(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if isTerminal(file) || isTerminal((*os.File)(nil)) {
+		t.Fatal("A regular file must not be a terminal")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package rlog
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// isTerminalFile returns true if the file refers to a terminal, which is the
+// case if the terminal settings can be read from it.
+func isTerminalFile(f *os.File) bool {
+	// Fd() would switch the file to blocking mode, SyscallConn() doesn't.
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		var termios syscall.Termios
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlReadTermios,
+			uintptr(unsafe.Pointer(&termios)))
+	})
+	return err == nil && errno == 0
+}
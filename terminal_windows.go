@@ -0,0 +1,36 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// isTerminalFile returns true if the file refers to a console, which is the
+// case if its console mode can be read.
+func isTerminalFile(f *os.File) bool {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var modeErr error
+	err = conn.Control(func(fd uintptr) {
+		var mode uint32
+		modeErr = syscall.GetConsoleMode(syscall.Handle(fd), &mode)
+	})
+	return err == nil && modeErr == nil
+}
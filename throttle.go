@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The maximum number of call sites, for which the time of the last message is
+// remembered by the throttled log functions, such as WarnEvery().
+const maxThrottleSites = 4096
+
+// throttleSite is the state of a call site of the throttled log functions.
+type throttleSite struct {
+	last       time.Time // when the last message was logged
+	suppressed int       // messages suppressed since then
+}
+
+// The throttled call sites, keyed by program counter.
+var (
+	throttleMutex sync.Mutex
+	throttleSites = map[uintptr]*throttleSite{}
+)
+
+// throttle decides whether a message of a throttled log function is logged.
+// That's the case if the call site didn't log a message within the given
+// duration. The returned extras hold the number of messages, which were
+// suppressed in between, if there were any. The calling log function needs to
+// be called directly by the program.
+func throttle(d time.Duration) (*logExtras, bool) {
+	var pcs [1]uintptr
+	// Skip runtime.Callers, throttle and the log function.
+	if runtime.Callers(3, pcs[:]) == 0 {
+		return nil, true
+	}
+	now := currentTime()
+
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	site := throttleSites[pcs[0]]
+	if site == nil {
+		if len(throttleSites) >= maxThrottleSites {
+			// Make room by forgetting sites, which would log their next
+			// message anyway. If there's still no room, the message is
+			// logged without throttling.
+			for pc, s := range throttleSites {
+				if now.Sub(s.last) >= d {
+					delete(throttleSites, pc)
+				}
+			}
+			if len(throttleSites) >= maxThrottleSites {
+				return nil, true
+			}
+		}
+		throttleSites[pcs[0]] = &throttleSite{last: now}
+		return nil, true
+	}
+	if now.Sub(site.last) < d {
+		site.suppressed++
+		atomic.AddUint64(&suppressedCount, 1)
+		return nil, false
+	}
+	var extras *logExtras
+	if site.suppressed > 0 {
+		extras = &logExtras{fields: Fields{"suppressed": site.suppressed}}
+	}
+	site.last = now
+	site.suppressed = 0
+	return extras, true
+}
+
+// DebugEvery logs a debug message, unless the same call site already logged
+// one within the given duration. This keeps messages, which may be triggered
+// very often, from flooding the log. The number of messages suppressed in
+// between is logged with the next message as field 'suppressed'.
+func DebugEvery(d time.Duration, a ...interface{}) {
+	if extras, ok := throttle(d); ok {
+		basicLog(levelDebug, notATrace, false, extras, "", "", a...)
+	}
+}
+
+// InfoEvery logs an info message, unless the same call site already logged one
+// within the given duration. See DebugEvery() for details.
+func InfoEvery(d time.Duration, a ...interface{}) {
+	if extras, ok := throttle(d); ok {
+		basicLog(levelInfo, notATrace, false, extras, "", "", a...)
+	}
+}
+
+// WarnEvery logs a warning, unless the same call site already logged one
+// within the given duration. See DebugEvery() for details.
+func WarnEvery(d time.Duration, a ...interface{}) {
+	if extras, ok := throttle(d); ok {
+		basicLog(levelWarn, notATrace, false, extras, "", "", a...)
+	}
+}
+
+// ErrorEvery logs an error message, unless the same call site already logged
+// one within the given duration. See DebugEvery() for details.
+func ErrorEvery(d time.Duration, a ...interface{}) {
+	if extras, ok := throttle(d); ok {
+		basicLog(levelErr, notATrace, false, extras, "", "", a...)
+	}
+}
+
+// CriticalEvery logs a critical message, unless the same call site already
+// logged one within the given duration. See DebugEvery() for details.
+func CriticalEvery(d time.Duration, a ...interface{}) {
+	if extras, ok := throttle(d); ok {
+		basicLog(levelCrit, notATrace, false, extras, "", "", a...)
+	}
+}
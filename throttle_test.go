@@ -0,0 +1,52 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWarnEvery checks that a call site logs at most one message within the
+// duration, and that suppressed messages are counted.
+func TestWarnEvery(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	for i := 0; i < 7; i++ {
+		WarnEvery(time.Minute, "Test Warning", i)
+		ErrorEvery(0, "Test Error", i)
+		now = now.Add(10 * time.Second)
+	}
+
+	checkLines := []string{
+		"WARN     : Test Warning 0",
+		"ERROR    : Test Error 0",
+		"ERROR    : Test Error 1",
+		"ERROR    : Test Error 2",
+		"ERROR    : Test Error 3",
+		"ERROR    : Test Error 4",
+		"ERROR    : Test Error 5",
+		"WARN     : Test Warning 6 suppressed=5",
+		"ERROR    : Test Error 6",
+	}
+	fileMatch(t, checkLines, "")
+}
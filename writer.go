@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Level words, which ParsingWriter recognizes at the start of a line. Common
+// variants used by other loggers are mapped to the closest rlog level.
+var parsingLevels = map[string]int{
+	"DEBUG":    levelDebug,
+	"INFO":     levelInfo,
+	"NOTICE":   levelInfo,
+	"WARN":     levelWarn,
+	"WARNING":  levelWarn,
+	"ERR":      levelErr,
+	"ERROR":    levelErr,
+	"CRIT":     levelCrit,
+	"CRITICAL": levelCrit,
+	"FATAL":    levelCrit,
+}
+
+// maxParsingLineLength is the length, up to which ParsingWriter waits for the
+// end of a line. Longer lines are split, so that a writer, which never ends
+// its lines, doesn't fill up the memory.
+const maxParsingLineLength = 64 * 1024
+
+// parsingWriter is the io.WriteCloser returned by ParsingWriter.
+type parsingWriter struct {
+	mutex sync.Mutex
+	buf   []byte // start of a line, which wasn't complete yet
+}
+
+// ParsingWriter returns a writer, which logs each line written to it as a
+// message. If the line starts with a level word, such as 'ERROR:', '[WARN]' or
+// 'debug', the message is logged at that level, without the level word.
+// Otherwise it's logged at INFO level. This allows the output of other
+// loggers, for example those of third-party libraries, to be sent through
+// rlog with the proper levels.
+//
+// Lines may be split across several writes, and a single write may contain
+// several lines. An incomplete last line is kept until it's completed by a
+// later write, or until the writer is closed. Lines longer than 64 KB are
+// logged in parts of that length. Caller info refers to the code, which wrote
+// to the writer.
+func ParsingWriter() io.WriteCloser {
+	return &parsingWriter{}
+}
+
+// Write logs all complete lines in p, together with any incomplete line from
+// earlier writes.
+func (w *parsingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		next := i + 1
+		if i < 0 || i > maxParsingLineLength {
+			if len(w.buf) < maxParsingLineLength {
+				break
+			}
+			i, next = maxParsingLineLength, maxParsingLineLength
+		}
+		level, msg := parseLevel(string(w.buf[:i]))
+		w.buf = w.buf[next:]
+		if msg != "" {
+			basicLog(level, notATrace, false, nil, "", "", msg)
+		}
+	}
+	// Don't keep the memory of a long line, which was logged already.
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// Close logs any incomplete last line.
+func (w *parsingWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if level, msg := parseLevel(string(w.buf)); msg != "" {
+		basicLog(level, notATrace, false, nil, "", "", msg)
+	}
+	w.buf = nil
+	return nil
+}
+
+// parseLevel determines the level of a line, as written to a ParsingWriter,
+// and returns it together with the rest of the line.
+func parseLevel(line string) (int, string) {
+	line = strings.TrimSpace(line)
+	token := line
+	rest := ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		token = line[:i]
+		rest = strings.TrimSpace(line[i+1:])
+	}
+	word := strings.ToUpper(strings.Trim(token, "[]():"))
+	if level, ok := parsingLevels[word]; ok {
+		return level, rest
+	}
+	return levelInfo, line
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestParsingWriter checks that lines written to the writer are logged at the
+// level named at their start, also when split across several writes.
+func TestParsingWriter(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	conf.logLevel = "DEBUG"
+	initialize(conf, true)
+	w := ParsingWriter()
+	w.Write([]byte("ERROR: Test Error\n[warn] Test"))
+	w.Write([]byte(" Warning\n\nTest Info\r\ndebug "))
+	w.Write([]byte("Test Debug\nFATAL"))
+	w.Close()
+
+	checkLines := []string{
+		"ERROR    : Test Error",
+		"WARN     : Test Warning",
+		"INFO     : Test Info",
+		"DEBUG    : Test Debug",
+	}
+	fileMatch(t, checkLines, "")
+}
+
+// TestParsingWriterLongLine checks that a line, which is never ended, is
+// logged in parts once it gets too long.
+func TestParsingWriterLongLine(t *testing.T) {
+	conf := setup()
+	defer cleanup()
+
+	initialize(conf, true)
+	var out bytes.Buffer
+	SetOutput(&out)
+	w := ParsingWriter().(*parsingWriter)
+	part := bytes.Repeat([]byte("x"), maxParsingLineLength/2)
+	for i := 0; i < 5; i++ {
+		w.Write(part)
+	}
+	if len(w.buf) > maxParsingLineLength {
+		t.Fatalf("Pending line wasn't limited: %d bytes", len(w.buf))
+	}
+	w.Write([]byte("\n"))
+
+	long := "INFO     : " + strings.Repeat("x", maxParsingLineLength)
+	shouldLines := []string{long, long, "INFO     : " + string(part)}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(shouldLines) {
+		t.Fatalf("Expected %d lines, but got %d", len(shouldLines), len(lines))
+	}
+	for i, line := range lines {
+		if line != shouldLines[i] {
+			t.Fatalf("Line %d has %d instead of %d bytes", i+1, len(line), len(shouldLines[i]))
+		}
+	}
+}